@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"awesomeProject11/notes"
+)
+
+// commands holds the subcommands that can be run instead of the demo.
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"configure-remote": configureRemoteCommand,
+	"audit-log":        auditLogCommand,
+}
+
+// runCommand runs the subcommand named by args[0] and returns the process exit code.
+func runCommand(args []string) int {
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+	if err := command(args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// configureRemoteCommand adds, reports or removes the notes configuration of a remote:
+//
+//	configure-remote [-push] [-rewrite] [-no-fetch] [-no-display] <remote> <namespace>...
+//	configure-remote -undo [...] <remote> <namespace>...
+//	configure-remote -status <remote>
+func configureRemoteCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("configure-remote", flag.ContinueOnError)
+	noFetch := fs.Bool("no-fetch", false, "do not add fetch refspecs")
+	noDisplay := fs.Bool("no-display", false, "do not add the namespaces to notes.displayRef")
+	push := fs.Bool("push", false, "add push refspecs (a plain `git push` then pushes only configured refspecs)")
+	rewrite := fs.Bool("rewrite", false, "add the namespaces to notes.rewriteRef")
+	undo := fs.Bool("undo", false, "remove the configuration instead of adding it")
+	status := fs.Bool("status", false, "report the notes configuration of the remote")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var report *notes.RemoteConfigReport
+	var err error
+	switch {
+	case *status:
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: configure-remote -status <remote>")
+		}
+		report, err = notes.RemoteNotesConfig(fs.Arg(0))
+	case fs.NArg() < 2:
+		return fmt.Errorf("usage: configure-remote [flags] <remote> <namespace>...")
+	default:
+		opts := notes.RemoteConfigOptions{Fetch: !*noFetch, Push: *push, DisplayRef: !*noDisplay, RewriteRef: *rewrite}
+		if *undo {
+			report, err = notes.UnconfigureRemote(fs.Arg(0), fs.Args()[1:], opts)
+		} else {
+			report, err = notes.ConfigureRemote(fs.Arg(0), fs.Args()[1:], opts)
+		}
+	}
+	if report != nil {
+		for _, change := range report.Changes {
+			fmt.Fprintf(stdout, "%-8s %s = %s\n", change.Action, change.Key, change.Value)
+		}
+	}
+	return err
+}
+
+// auditLogCommand prints the changes made to the notes of a namespace, newest first:
+//
+//	audit-log [-target <commit>] [-author <name or email>] [-since <time>] [-until <time>] [<namespace>]
+//
+// Times are RFC 3339 timestamps or YYYY-MM-DD dates.
+func auditLogCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("audit-log", flag.ContinueOnError)
+	target := fs.String("target", "", "only report changes to the note of this commit")
+	author := fs.String("author", "", "only report changes whose author name or email contains this")
+	since := fs.String("since", "", "only report changes committed at or after this time")
+	until := fs.String("until", "", "only report changes committed before this time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: audit-log [flags] [<namespace>]")
+	}
+
+	opts := notes.AuditLogOptions{Namespace: fs.Arg(0), Target: *target, Author: *author}
+	var err error
+	if opts.Since, err = parseTimeFlag("since", *since); err != nil {
+		return err
+	}
+	if opts.Until, err = parseTimeFlag("until", *until); err != nil {
+		return err
+	}
+	changes, err := notes.AuditLog(opts)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Fprintf(stdout, "%s %.12s %-6s %s %s -> %s  %s\n",
+			change.Committer.When.Format(time.RFC3339), change.NotesCommit, change.Operation, change.Target,
+			blobOrDash(change.OldBlob), blobOrDash(change.NewBlob), change.Author)
+	}
+	return nil
+}
+
+// parseTimeFlag parses the value of a time flag; an empty value is the zero time.
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q: expected RFC 3339 or YYYY-MM-DD", name, value)
+	}
+	return t, nil
+}
+
+func blobOrDash(blob string) string {
+	if blob == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%.12s", blob)
+}
@@ -2,31 +2,34 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"awesomeProject11/notes"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
-	fmt.Println("Creating manager... ")
-	manager := notes.NewTimedNotesManager(notes.NewNotesManager("dd_notes"))
-
-	fmt.Println("Fetching notes... ")
-	err := manager.FetchNotes("origin")
-	if err != nil {
-		fmt.Println("Error fetching notes:", err)
+	namespaces := []notes.Namespace{
+		{Name: "dd_notes"},
+		{Name: "dd_notes_json", Options: []notes.Option{notes.WithMergeFunc(notes.JSONMergeFunc(""))}},
 	}
 
 	defer func() {
-		fmt.Println("Pushing notes... ")
-		err := manager.PushNotes("origin")
+		fmt.Println("Syncing notes... ")
+		_, err := notes.SyncNamespaces("origin", namespaces)
 		if err != nil {
-			fmt.Println("Error pushing notes:", err)
+			fmt.Println("Error syncing notes:", err)
 			return
 		}
 	}()
 
+	fmt.Println("Creating manager... ")
+	manager := notes.NewTimedNotesManager(notes.NewNotesManager("dd_notes", notes.WithMissingRefAsEmpty()))
+
 	fmt.Println("Shas with notes:")
 	shas, err := manager.GetNoteList()
 	if err != nil {
@@ -66,12 +69,8 @@ func main() {
 		fmt.Println("Error setting note:", err)
 	}
 
-	fmt.Println("Creating manager for JSON and fetching...")
+	fmt.Println("Creating manager for JSON...")
 	jsonManager := notes.NewTimedNotesManager(notes.NewNotesManager("dd_notes_json"))
-	_ = jsonManager.FetchNotes("origin")
-	defer func() {
-		_ = jsonManager.PushNotes("origin")
-	}()
 
 	m := map[string]string{
 		"test":  "test",
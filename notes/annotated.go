@@ -0,0 +1,180 @@
+package notes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AnnotatedCommitsMode selects how FetchNotes brings in the commits annotated by the fetched notes.
+type AnnotatedCommitsMode int
+
+const (
+	// FetchAnnotatedBySha fetches the annotated commits that are missing locally by SHA. The server
+	// must allow fetching unadvertised objects (protocol v2 or uploadpack.allowReachableSHA1InWant).
+	FetchAnnotatedBySha AnnotatedCommitsMode = iota
+	// SkipAnnotatedCommits fetches only the notes.
+	SkipAnnotatedCommits
+	// FetchAnnotatedFromBranches fetches the configured branches into their remote-tracking refs
+	// instead of fetching commits by SHA. Annotated commits those branches do not contain are
+	// reported as missing.
+	FetchAnnotatedFromBranches
+)
+
+func (m AnnotatedCommitsMode) String() string {
+	switch m {
+	case FetchAnnotatedBySha:
+		return "by_sha"
+	case SkipAnnotatedCommits:
+		return "skip"
+	case FetchAnnotatedFromBranches:
+		return "from_branches"
+	default:
+		return "AnnotatedCommitsMode(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// AnnotatedCommitsConfig configures the fetch of annotated commits after the notes are fetched.
+type AnnotatedCommitsConfig struct {
+	Mode AnnotatedCommitsMode
+	// Depth, if positive, limits the history fetched with each commit (`git fetch --depth`), which
+	// keeps shallow clones shallow.
+	Depth int
+	// Filter, if set, is passed as `git fetch --filter`, e.g. "blob:none". Git then records the
+	// remote as a promisor remote of a partial clone. Servers that do not support filtering ignore it.
+	Filter string
+	// Branches are the branches fetched by FetchAnnotatedFromBranches, e.g. "main" or "refs/heads/main".
+	Branches []string
+}
+
+// WithAnnotatedCommits configures how FetchNotes fetches the commits annotated by the fetched
+// notes. The default is FetchAnnotatedBySha without depth or filter.
+func WithAnnotatedCommits(config AnnotatedCommitsConfig) Option {
+	return func(m *notesManager) {
+		m.annotatedCommits = config
+	}
+}
+
+// AnnotatedCommitsResult reports the fetch of annotated commits made by FetchNotes.
+type AnnotatedCommitsResult struct {
+	Mode AnnotatedCommitsMode
+	// Annotated is the number of commits annotated by the local notes after the fetch.
+	Annotated int
+	// Requested is the number of annotated commits that were missing locally before the fetch.
+	Requested int
+	// Missing lists the annotated commits still missing locally after the fetch, sorted.
+	Missing []string
+	// Err is the error of the fetch. It does not fail FetchNotes, since the notes themselves
+	// have been fetched.
+	Err error
+}
+
+// Complete reports whether every annotated commit is available locally.
+func (r *AnnotatedCommitsResult) Complete() bool {
+	return r.Err == nil && len(r.Missing) == 0
+}
+
+// fetchAnnotatedCommits fetches the commits referenced by the local notes so that they can be
+// inspected locally, as configured by WithAnnotatedCommits, and reports the outcome.
+func (m *notesManager) fetchAnnotatedCommits(remote Remote) *AnnotatedCommitsResult {
+	config := m.annotatedCommits
+	result := &AnnotatedCommitsResult{Mode: config.Mode}
+	if config.Mode == SkipAnnotatedCommits {
+		return result
+	}
+
+	annotated, err := m.annotatedCommitShas()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Annotated = len(annotated)
+	missing, err := missingObjects(m.gitContext(), annotated)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Requested = len(missing)
+	if len(missing) == 0 {
+		return result
+	}
+
+	fetchArgs := []string{"fetch", "--no-tags"}
+	if config.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth="+strconv.Itoa(config.Depth))
+	}
+	if config.Filter != "" {
+		fetchArgs = append(fetchArgs, "--filter="+config.Filter)
+	}
+	fetchArgs = append(fetchArgs, remote.target())
+
+	switch config.Mode {
+	case FetchAnnotatedFromBranches:
+		if len(config.Branches) == 0 {
+			result.Missing = missing
+			result.Err = fmt.Errorf("no branches configured to fetch annotated commits from")
+			return result
+		}
+		for _, branch := range config.Branches {
+			branch = strings.TrimPrefix(branch, "refs/heads/")
+			fetchArgs = append(fetchArgs, "+refs/heads/"+branch+":"+remote.trackingRefPrefix()+branch)
+		}
+	default:
+		// Prepare arguments for `git fetch <remote> <sha1> <sha2> ...`
+		fetchArgs = append(fetchArgs, missing...)
+	}
+
+	_, stderr, fetchErr := remote.git(m.gitContext(), fetchArgs...)
+	if fetchErr != nil {
+		result.Err = fmt.Errorf("failed to fetch annotated commits of %s from %s (stderr: %s): %w", m.ref, remote, stderr, fetchErr)
+	}
+	if result.Missing, err = missingObjects(m.gitContext(), missing); err != nil && result.Err == nil {
+		result.Err = err
+	}
+	return result
+}
+
+// annotatedCommitShas lists the commits annotated by the local notes, sorted.
+func (m *notesManager) annotatedCommitShas() ([]string, error) {
+	listOutput, stderr, err := m.git("notes", "--ref", m.ref, "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes in %s (stderr: %s): %w", m.ref, stderr, err)
+	}
+
+	var shas []string
+	scanner := bufio.NewScanner(strings.NewReader(listOutput))
+	for scanner.Scan() {
+		// Output of `git notes list` is "<note-object-sha> <commit-sha>"
+		if parts := strings.Fields(scanner.Text()); len(parts) >= 2 {
+			shas = append(shas, parts[1])
+		}
+	}
+	sort.Strings(shas)
+	return shas, scanner.Err()
+}
+
+// missingObjects returns the objects of shas that are not in the local object database, in order.
+func missingObjects(ctx context.Context, shas []string) ([]string, error) {
+	if len(shas) == 0 {
+		return nil, nil
+	}
+	// GIT_NO_LAZY_FETCH keeps partial clones from fetching each missing object on its own.
+	output, stderr, err := runGitCommand(ctx, strings.NewReader(strings.Join(shas, "\n")+"\n"),
+		[]string{"GIT_NO_LAZY_FETCH=1"}, "cat-file", "--batch-check=%(objectname)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check annotated commits (stderr: %s): %w", stderr, err)
+	}
+
+	var missing []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// Missing objects are reported as "<sha> missing"
+		if sha, found := strings.CutSuffix(scanner.Text(), " missing"); found {
+			missing = append(missing, sha)
+		}
+	}
+	return missing, scanner.Err()
+}
@@ -0,0 +1,80 @@
+package notes
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFetchAnnotatedCommits(t *testing.T) {
+	localPath, _, clonePath, _ := setupRemoteTestRepos(t)
+	ref := formatNamespaceRef("annotated")
+
+	// Commits that only the remote has, on two branches, each with a note.
+	runCmd(t, clonePath, "git", "checkout", "-b", "feature")
+	featureSha := createTestCommit(t, clonePath, "feature.txt", "feature", "Feature commit")
+	runCmd(t, clonePath, "git", "checkout", "-b", "other", "origin/main")
+	otherSha := createTestCommit(t, clonePath, "other.txt", "other", "Other commit")
+	runCmd(t, clonePath, "git", "push", "origin", "feature", "other")
+	runCmd(t, clonePath, "git", "notes", "--ref", ref, "add", "-m", "feature note", featureSha)
+	pushNoteFromClone(t, clonePath, ref, otherSha, "other note")
+
+	hasObject := func(sha string) bool {
+		_, _, err := executeGitCommand("cat-file", "-e", sha)
+		return err == nil
+	}
+	fetch := func(t *testing.T, config AnnotatedCommitsConfig) *AnnotatedCommitsResult {
+		t.Helper()
+		result, err := NewNotesManager("annotated", WithAnnotatedCommits(config)).FetchNotesWithResult("testorigin")
+		if err != nil {
+			t.Fatalf("FetchNotesWithResult failed: %v", err)
+		}
+		if result.AnnotatedCommits == nil {
+			t.Fatal("Expected the annotated commits fetch to be reported")
+		}
+		return result.AnnotatedCommits
+	}
+
+	t.Run("Skip", func(t *testing.T) {
+		r := fetch(t, AnnotatedCommitsConfig{Mode: SkipAnnotatedCommits})
+		if r.Requested != 0 || r.Err != nil || hasObject(featureSha) || hasObject(otherSha) {
+			t.Errorf("Expected no commits to be fetched, got %+v", r)
+		}
+		if note, err := NewNotesManager("annotated").GetNote(featureSha); err != nil || note != "feature note" {
+			t.Errorf("Expected the notes to be fetched, got %q (%v)", note, err)
+		}
+	})
+
+	t.Run("FromBranches", func(t *testing.T) {
+		r := fetch(t, AnnotatedCommitsConfig{Mode: FetchAnnotatedFromBranches, Branches: []string{"refs/heads/feature"}, Depth: 1})
+		if r.Annotated != 2 || r.Requested != 2 || len(r.Missing) != 1 || r.Missing[0] != otherSha || r.Complete() {
+			t.Errorf("Expected only the commit off the branch to be missing, got %+v", r)
+		}
+		if !hasObject(featureSha) || refTip(context.Background(), "refs/remotes/testorigin/feature") != featureSha {
+			t.Error("Expected the branch to be fetched into its remote-tracking ref")
+		}
+	})
+
+	t.Run("BySha", func(t *testing.T) {
+		r := fetch(t, AnnotatedCommitsConfig{Depth: 1, Filter: "blob:none"})
+		if r.Requested != 1 || !r.Complete() || !hasObject(otherSha) {
+			t.Errorf("Expected the missing commit to be fetched, got %+v", r)
+		}
+		if r := fetch(t, AnnotatedCommitsConfig{}); r.Requested != 0 || !r.Complete() {
+			t.Errorf("Expected nothing to fetch, got %+v", r)
+		}
+	})
+
+	t.Run("ReportsFailure", func(t *testing.T) {
+		// The remote has a note for a commit it does not have.
+		unpushedSha := createTestCommit(t, clonePath, "unpushed.txt", "unpushed", "Unpushed commit")
+		pushNoteFromClone(t, clonePath, ref, unpushedSha, "dangling note")
+
+		r := fetch(t, AnnotatedCommitsConfig{})
+		if r.Err == nil || len(r.Missing) != 1 || r.Missing[0] != unpushedSha {
+			t.Errorf("Expected the failed fetch to be reported, got %+v", r)
+		}
+		if out, _ := runCmd(t, localPath, "git", "notes", "--ref", ref, "show", unpushedSha); out != "dangling note" {
+			t.Errorf("Expected the notes to be fetched anyway, got %q", out)
+		}
+	})
+}
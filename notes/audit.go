@@ -0,0 +1,171 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitCommand describes a git command run by the package. Secrets are redacted from Args and Env.
+type GitCommand struct {
+	// Namespace is the notes ref of the manager the command was run for.
+	Namespace string
+	// Args are the arguments passed to git, without "git" itself.
+	Args []string
+	// Dir is the working directory of the command.
+	Dir string
+	// Env holds the "KEY=value" entries set by the package on top of the inherited environment.
+	Env   []string
+	Start time.Time
+
+	// The fields below are set after the command finished.
+	Duration time.Duration
+	// ExitCode is -1 if git could not be started or was killed.
+	ExitCode int
+	// BytesIn and BytesOut are the sizes of the command's stdin and stdout.
+	BytesIn  int64
+	BytesOut int64
+	Err      error
+}
+
+// CommandHooks are called before and after each git command run for a manager created by
+// NewAuditedNotesManager or with WithCommandHooks, or by a package-level function given hooks in
+// its options. Either may be nil. Hooks are called from the goroutine running the command, and may
+// be called concurrently.
+type CommandHooks struct {
+	Before func(command GitCommand)
+	After  func(command GitCommand)
+}
+
+const redacted = "REDACTED"
+
+// sensitivePattern matches the names of environment variables and configuration keys that may
+// hold secrets.
+var sensitivePattern = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|credential|authorization|extraheader|cookie|api_?key|private_?key)`)
+
+// redactArgs returns a copy of args without the values of sensitive `-c key=value` overrides and
+// without the credentials of URLs.
+func redactArgs(args []string) []string {
+	redactedArgs := make([]string, len(args))
+	for i, arg := range args {
+		if i > 0 && args[i-1] == "-c" {
+			if key, _, ok := strings.Cut(arg, "="); ok && sensitivePattern.MatchString(key) {
+				arg = key + "=" + redacted
+			}
+		} else if strings.Contains(arg, "://") {
+			if u, err := url.Parse(arg); err == nil && u.User != nil {
+				u.User = url.User(redacted)
+				arg = u.String()
+			}
+		}
+		redactedArgs[i] = arg
+	}
+	return redactedArgs
+}
+
+// redactEnv returns a copy of env without the values of sensitive variables.
+func redactEnv(env []string) []string {
+	redactedEnv := make([]string, len(env))
+	for i, entry := range env {
+		if key, _, ok := strings.Cut(entry, "="); ok && sensitivePattern.MatchString(key) {
+			entry = key + "=" + redacted
+		}
+		redactedEnv[i] = entry
+	}
+	return redactedEnv
+}
+
+// WithCommandHooks makes the manager call hooks before and after each git command it runs. The
+// commands are reported with the manager's notes ref as their Namespace.
+func WithCommandHooks(hooks CommandHooks) Option {
+	return func(m *notesManager) {
+		m.hooks = &hooks
+	}
+}
+
+// withCommandHooks returns a copy of ctx whose git commands are reported to hooks under namespace.
+// Hooks already added to ctx are replaced, so each command is reported to them once.
+func withCommandHooks(ctx context.Context, namespace string, hooks *CommandHooks) context.Context {
+	return withGitCommandListener(ctx, hooks, func(command *GitCommand) func() {
+		if hooks.Before != nil {
+			before := *command
+			before.Namespace = namespace
+			hooks.Before(before)
+		}
+		return func() {
+			if hooks.After != nil {
+				after := *command
+				after.Namespace = namespace
+				hooks.After(after)
+			}
+		}
+	})
+}
+
+// hooksContext returns the context the git commands of a package-level function are run with:
+// one reporting them to hooks under namespace, if any hook is set.
+func hooksContext(namespace string, hooks CommandHooks) context.Context {
+	ctx := context.Background()
+	if hooks.Before == nil && hooks.After == nil {
+		return ctx
+	}
+	return withCommandHooks(ctx, namespace, &hooks)
+}
+
+// NewAuditedNotesManager wraps manager so that hooks are called for every git command run by its
+// calls. GetRef runs no git command.
+func NewAuditedNotesManager(manager NotesManager, hooks CommandHooks) NotesManager {
+	return &instrumentedNotesManager{NotesManager: manager, instrument: auditCalls(manager, &hooks)}
+}
+
+// auditCalls returns the instrumenter running the calls of manager with a context reporting their
+// git commands to hooks.
+func auditCalls(manager NotesManager, hooks *CommandHooks) callInstrumenter {
+	return func(ctx context.Context, _ managerCall) (context.Context, func(any, error)) {
+		return withCommandHooks(ctx, manager.GetRef(), hooks), nil
+	}
+}
+
+// auditRecord is a line written by the JSONL audit logger.
+type auditRecord struct {
+	Time       time.Time `json:"time"`
+	Namespace  string    `json:"namespace"`
+	Args       []string  `json:"args"`
+	Dir        string    `json:"dir"`
+	Env        []string  `json:"env"`
+	DurationMs float64   `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewJSONLAuditLogger returns CommandHooks writing one JSON object per finished git command to w,
+// one per line. Write errors are ignored.
+func NewJSONLAuditLogger(w io.Writer) CommandHooks {
+	var mu sync.Mutex
+	return CommandHooks{After: func(command GitCommand) {
+		record := auditRecord{
+			Time:       command.Start.UTC(),
+			Namespace:  command.Namespace,
+			Args:       command.Args,
+			Dir:        command.Dir,
+			Env:        command.Env,
+			DurationMs: float64(command.Duration.Microseconds()) / 1000,
+			ExitCode:   command.ExitCode,
+		}
+		if command.Err != nil {
+			record.Error = command.Err.Error()
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}}
+}
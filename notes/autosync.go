@@ -0,0 +1,258 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAutoSyncInterval is how often an AutoSyncer fetches and pushes when not configured otherwise.
+	DefaultAutoSyncInterval = time.Minute
+	// DefaultAutoSyncDebounce is how long an AutoSyncer waits after a write before pushing.
+	DefaultAutoSyncDebounce = time.Second
+)
+
+// ErrAutoSyncerNotRunning is returned by SyncNow when the syncer's Run loop is not active.
+var ErrAutoSyncerNotRunning = errors.New("auto syncer is not running")
+
+// AutoSyncConfig configures an AutoSyncer.
+type AutoSyncConfig struct {
+	// Remote is the remote to fetch from and push to.
+	Remote Remote
+	// Interval is the period of the background sync. Zero means DefaultAutoSyncInterval.
+	Interval time.Duration
+	// Debounce is how long to wait for further writes before pushing. Every write restarts the
+	// wait, up to MaxDelay after the first unpushed write. Zero means DefaultAutoSyncDebounce.
+	Debounce time.Duration
+	// MaxDelay bounds how long writes are coalesced. Zero means 10 times Debounce.
+	MaxDelay time.Duration
+	// MaxRetries is passed to PushNotesWithResult. Zero means DefaultRetryAttempts.
+	MaxRetries int
+	// OnSync, if set, is called by the worker after every sync with the updated health.
+	OnSync func(AutoSyncHealth)
+}
+
+// AutoSyncHealth describes the state of an AutoSyncer.
+type AutoSyncHealth struct {
+	// Running reports whether Run is active.
+	Running bool
+	// PendingWrites is the number of local writes not pushed yet.
+	PendingWrites int
+	// LastSync is when the last sync finished and LastError its error (nil on success).
+	LastSync  time.Time
+	LastError error
+	// LastSuccess is when a sync last succeeded.
+	LastSuccess time.Time
+	// ConsecutiveFailures counts the failed syncs since the last success.
+	ConsecutiveFailures int
+	// LastFetch and LastPush are the results of the last fetch and push, if any.
+	LastFetch *FetchResult
+	LastPush  *PushResult
+}
+
+// Healthy reports whether the last sync succeeded (or none has run yet).
+func (h AutoSyncHealth) Healthy() bool {
+	return h.LastError == nil
+}
+
+// AutoSyncer wraps a NotesManager for long-running services. Writes go to the local notes ref
+// immediately; a background worker started with Run coalesces them and pushes after a debounce
+// delay, and periodically fetches and pushes to keep the local notes current. Remote notes are
+// merged with the wrapped manager's merge strategy.
+type AutoSyncer struct {
+	NotesManager
+	config AutoSyncConfig
+
+	writes   chan struct{}
+	requests chan chan error
+
+	mu     sync.Mutex
+	health AutoSyncHealth
+}
+
+// NewAutoSyncer returns an AutoSyncer for manager. Call Run to start syncing.
+func NewAutoSyncer(manager NotesManager, config AutoSyncConfig) *AutoSyncer {
+	if config.Interval <= 0 {
+		config.Interval = DefaultAutoSyncInterval
+	}
+	if config.Debounce <= 0 {
+		config.Debounce = DefaultAutoSyncDebounce
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = 10 * config.Debounce
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = DefaultRetryAttempts
+	}
+	return &AutoSyncer{
+		NotesManager: manager,
+		config:       config,
+		writes:       make(chan struct{}, 1),
+		requests:     make(chan chan error),
+	}
+}
+
+// SetNote sets the note locally and schedules a push.
+func (s *AutoSyncer) SetNote(commitSha, value string) error {
+	if err := s.NotesManager.SetNote(commitSha, value); err != nil {
+		return err
+	}
+	s.recordWrite()
+	return nil
+}
+
+// DeleteNote removes the note locally and schedules a push.
+func (s *AutoSyncer) DeleteNote(commitSha string) error {
+	if err := s.NotesManager.DeleteNote(commitSha); err != nil {
+		return err
+	}
+	s.recordWrite()
+	return nil
+}
+
+func (s *AutoSyncer) recordWrite() {
+	s.mu.Lock()
+	s.health.PendingWrites++
+	s.mu.Unlock()
+
+	select {
+	case s.writes <- struct{}{}:
+	default:
+	}
+}
+
+// Health returns a snapshot of the syncer's state.
+func (s *AutoSyncer) Health() AutoSyncHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+// SyncNow asks the running worker to fetch and push immediately and waits for the outcome.
+// It returns ErrAutoSyncerNotRunning if Run is not active.
+func (s *AutoSyncer) SyncNow(ctx context.Context) error {
+	if !s.Health().Running {
+		return ErrAutoSyncerNotRunning
+	}
+	reply := make(chan error, 1)
+	select {
+	case s.requests <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run syncs in the background until ctx is done. Before returning it pushes any writes that are
+// still pending and returns the error of that final push. Run must not be called concurrently.
+func (s *AutoSyncer) Run(ctx context.Context) error {
+	if err := s.config.Remote.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.health.Running {
+		s.mu.Unlock()
+		return fmt.Errorf("auto syncer for %s is already running", s.GetRef())
+	}
+	s.health.Running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.health.Running = false
+		s.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	var firstWrite time.Time
+	syncNow := func() error {
+		firstWrite = time.Time{}
+		debounce.Stop()
+		return s.sync()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if s.Health().PendingWrites == 0 {
+				return nil
+			}
+			return s.sync()
+
+		case <-s.writes:
+			now := time.Now()
+			if firstWrite.IsZero() {
+				firstWrite = now
+			}
+			wait := s.config.Debounce
+			if remaining := s.config.MaxDelay - now.Sub(firstWrite); remaining < wait {
+				wait = max(remaining, 0)
+			}
+			debounce.Reset(wait)
+
+		case <-debounce.C:
+			_ = syncNow()
+
+		case <-ticker.C:
+			_ = syncNow()
+
+		case reply := <-s.requests:
+			reply <- syncNow()
+		}
+	}
+}
+
+// sync pushes pending writes (which also merges remote notes) or, if there are none, fetches.
+func (s *AutoSyncer) sync() error {
+	s.mu.Lock()
+	pending := s.health.PendingWrites
+	s.mu.Unlock()
+
+	var fetch *FetchResult
+	var push *PushResult
+	var err error
+	if pending > 0 {
+		push, err = s.PushNotesTo(s.config.Remote, s.config.MaxRetries)
+	} else {
+		fetch, err = s.FetchNotesFrom(s.config.Remote)
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	s.health.LastSync = now
+	s.health.LastError = err
+	if fetch != nil {
+		s.health.LastFetch = fetch
+	}
+	if push != nil {
+		s.health.LastPush = push
+	}
+	if err != nil {
+		s.health.ConsecutiveFailures++
+	} else {
+		s.health.LastSuccess = now
+		s.health.ConsecutiveFailures = 0
+		// Writes recorded while the push ran are left for the next sync.
+		s.health.PendingWrites -= pending
+	}
+	health := s.health
+	s.mu.Unlock()
+
+	if s.config.OnSync != nil {
+		s.config.OnSync(health)
+	}
+	return err
+}
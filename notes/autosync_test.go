@@ -0,0 +1,104 @@
+package notes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoSyncer(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	shas := []string{
+		createTestCommit(t, localPath, "a.txt", "a", "Commit A"),
+		createTestCommit(t, localPath, "b.txt", "b", "Commit B"),
+		createTestCommit(t, localPath, "c.txt", "c", "Commit C"),
+	}
+
+	syncs := make(chan AutoSyncHealth, 10)
+	syncer := NewAutoSyncer(NewNotesManager("autosync"), AutoSyncConfig{
+		Remote:   NamedRemote("testorigin"),
+		Interval: time.Hour,
+		Debounce: 100 * time.Millisecond,
+		OnSync:   func(h AutoSyncHealth) { syncs <- h },
+	})
+	if err := syncer.SyncNow(context.Background()); err != ErrAutoSyncerNotRunning {
+		t.Fatalf("Expected ErrAutoSyncerNotRunning, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- syncer.Run(ctx) }()
+	for !syncer.Health().Running {
+		time.Sleep(time.Millisecond)
+	}
+
+	remoteTip := func() string {
+		out, _ := runCmd(t, localPath, "git", "ls-remote", "testorigin", syncer.GetRef())
+		return strings.Fields(out + " ")[0]
+	}
+
+	t.Run("CoalescesWrites", func(t *testing.T) {
+		for _, sha := range shas {
+			if err := syncer.SetNote(sha, "note "+sha); err != nil {
+				t.Fatalf("SetNote failed: %v", err)
+			}
+		}
+		select {
+		case health := <-syncs:
+			if !health.Healthy() || health.LastPush == nil || health.PendingWrites != 0 {
+				t.Fatalf("Unexpected health after push: %+v", health)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for the debounced push")
+		}
+		select {
+		case health := <-syncs:
+			t.Fatalf("Expected the writes to be pushed at once, got another sync: %+v", health)
+		case <-time.After(300 * time.Millisecond):
+		}
+		if tip := remoteTip(); tip != refTip(context.Background(), syncer.GetRef()) {
+			t.Errorf("Expected remote tip %s, got %s", refTip(context.Background(), syncer.GetRef()), tip)
+		}
+	})
+
+	t.Run("SyncNowFetches", func(t *testing.T) {
+		runCmd(t, clonePath, "git", "fetch", "origin", "+"+syncer.GetRef()+":"+syncer.GetRef())
+		pushNoteFromClone(t, clonePath, syncer.GetRef(), commitSha, "remote note")
+		if err := syncer.SyncNow(context.Background()); err != nil {
+			t.Fatalf("SyncNow failed: %v", err)
+		}
+		<-syncs
+		health := syncer.Health()
+		if health.LastFetch == nil || !health.LastFetch.Transferred() || health.LastSuccess.IsZero() {
+			t.Errorf("Expected SyncNow to fetch the remote note, got %+v", health)
+		}
+		if note, err := syncer.GetNote(commitSha); err != nil || !strings.Contains(note, "remote note") {
+			t.Errorf("Expected the remote note locally, got %q (%v)", note, err)
+		}
+	})
+
+	t.Run("ShutdownFlushesPendingWrites", func(t *testing.T) {
+		syncer.config.Debounce = time.Hour
+		syncer.config.MaxDelay = time.Hour
+		if err := syncer.DeleteNote(shas[0]); err != nil {
+			t.Fatalf("DeleteNote failed: %v", err)
+		}
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Run returned an error: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for Run to return")
+		}
+		health := syncer.Health()
+		if health.Running || health.PendingWrites != 0 {
+			t.Errorf("Unexpected health after shutdown: %+v", health)
+		}
+		if tip := remoteTip(); tip != refTip(context.Background(), syncer.GetRef()) {
+			t.Errorf("Expected the final push to reach the remote, remote tip %s, local %s", tip, refTip(context.Background(), syncer.GetRef()))
+		}
+	})
+}
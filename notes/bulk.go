@@ -0,0 +1,146 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BulkErrorCategory classifies the failures collected in a BulkError.
+type BulkErrorCategory string
+
+const (
+	// CategoryNotFound covers missing notes and notes refs.
+	CategoryNotFound BulkErrorCategory = "not_found"
+	// CategoryInvalid covers invalid or unknown commit SHAs.
+	CategoryInvalid BulkErrorCategory = "invalid"
+	// CategoryCanceled covers items abandoned because the context was canceled or timed out.
+	CategoryCanceled BulkErrorCategory = "canceled"
+	// CategoryConflict covers merge conflicts and rejected pushes.
+	CategoryConflict BulkErrorCategory = "conflict"
+	// CategoryRemote covers missing remotes, authentication failures and network errors.
+	CategoryRemote BulkErrorCategory = "remote"
+	// CategoryOther covers every other failure.
+	CategoryOther BulkErrorCategory = "other"
+)
+
+// categorize returns the BulkErrorCategory of err.
+func categorize(err error) BulkErrorCategory {
+	switch {
+	case IsNoteNotFound(err) || IsNotesRefNotFound(err):
+		return CategoryNotFound
+	case IsInvalidCommitSha(err):
+		return CategoryInvalid
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return CategoryCanceled
+	case IsMergeConflict(err) || IsPushRejected(err):
+		return CategoryConflict
+	case IsRemoteNotFound(err) || IsAuthenticationError(err) || IsNetworkError(err):
+		return CategoryRemote
+	default:
+		return CategoryOther
+	}
+}
+
+// BulkItemError is the failure of a single item of a batch operation.
+type BulkItemError struct {
+	// Key identifies the item, e.g. the commit SHA or the notes ref.
+	Key      string
+	Category BulkErrorCategory
+	Err      error
+}
+
+func (e *BulkItemError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *BulkItemError) Unwrap() error {
+	return e.Err
+}
+
+// BulkError is returned by batch operations when some of their items failed. errors.Is and
+// errors.As look into the failures of all items.
+type BulkError struct {
+	Operation string
+	// Total is the number of items in the batch.
+	Total int
+	// Items are the failed items, sorted by key.
+	Items []*BulkItemError
+}
+
+// newBulkError collects the failures of a batch of total items keyed by item. It returns nil if
+// there are none.
+func newBulkError(operation string, total int, failures map[string]error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	e := &BulkError{Operation: operation, Total: total}
+	for key, err := range failures {
+		e.Items = append(e.Items, &BulkItemError{Key: key, Category: categorize(err), Err: err})
+	}
+	sort.Slice(e.Items, func(i, j int) bool { return e.Items[i].Key < e.Items[j].Key })
+	return e
+}
+
+func (e *BulkError) Error() string {
+	counts := e.Counts()
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+	for i, category := range categories {
+		categories[i] = fmt.Sprintf("%d %s", counts[BulkErrorCategory(category)], category)
+	}
+	return fmt.Sprintf("%s failed for %d of %d items (%s); first: %v",
+		e.Operation, len(e.Items), e.Total, strings.Join(categories, ", "), e.Items[0])
+}
+
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, len(e.Items))
+	for i, item := range e.Items {
+		errs[i] = item
+	}
+	return errs
+}
+
+// Counts returns the number of failed items per category.
+func (e *BulkError) Counts() map[BulkErrorCategory]int {
+	counts := make(map[BulkErrorCategory]int)
+	for _, item := range e.Items {
+		counts[item.Category]++
+	}
+	return counts
+}
+
+// Err returns the error of the item with the given key, or nil if it did not fail.
+func (e *BulkError) Err(key string) error {
+	for _, item := range e.Items {
+		if item.Key == key {
+			return item.Err
+		}
+	}
+	return nil
+}
+
+// Only reports whether every failed item is in one of the given categories, e.g. to tell
+// a batch that only found missing notes from one with real failures.
+func (e *BulkError) Only(categories ...BulkErrorCategory) bool {
+	for _, item := range e.Items {
+		found := false
+		for _, category := range categories {
+			found = found || item.Category == category
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func IsBulkError(err error) bool {
+	var nf *BulkError
+	return errors.As(err, &nf)
+}
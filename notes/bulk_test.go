@@ -0,0 +1,61 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetNotesBulkWithContext(t *testing.T) {
+	repoPath := setupTestRepo(t)
+	withNote := createTestCommit(t, repoPath, "a.txt", "a", "With note")
+	withoutNote := createTestCommit(t, repoPath, "b.txt", "b", "Without note")
+	chdirForTest(t, repoPath)
+	if err := NewNotesManager("bulk").SetNote(withNote, "note"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	shas := []string{withNote, withoutNote, "not-a-sha"}
+
+	t.Run("CollectsFailures", func(t *testing.T) {
+		notes, err := NewNotesManager("bulk").GetNotesBulkWithContext(context.Background(), shas)
+		if len(notes) != 1 || notes[withNote] != "note" {
+			t.Errorf("Expected the existing note, got %v", notes)
+		}
+		var bulkErr *BulkError
+		if !errors.As(err, &bulkErr) {
+			t.Fatalf("Expected a BulkError, got %v", err)
+		}
+		counts := bulkErr.Counts()
+		if bulkErr.Total != 3 || len(bulkErr.Items) != 2 || counts[CategoryNotFound] != 1 || counts[CategoryInvalid] != 1 {
+			t.Errorf("Unexpected failures: %v", bulkErr)
+		}
+		if !IsNoteNotFound(err) || !IsInvalidCommitSha(err) || !IsNoteNotFound(bulkErr.Err(withoutNote)) {
+			t.Error("Expected errors.As to find the failures of every item")
+		}
+		if bulkErr.Only(CategoryNotFound) {
+			t.Error("Expected the invalid SHA to be a real failure")
+		}
+	})
+
+	t.Run("MissingNotesAsAbsent", func(t *testing.T) {
+		manager := NewNotesManager("bulk", WithMissingNotesAsAbsent())
+		_, err := manager.GetNotesBulkWithContext(context.Background(), shas[:2])
+		if err != nil {
+			t.Errorf("Expected missing notes not to fail, got %v", err)
+		}
+		notes, failures := manager.GetNotesBulk(shas)
+		if len(notes) != 1 || len(failures) != 1 || failures["not-a-sha"] == nil {
+			t.Errorf("Expected only the invalid SHA to fail, got %v %v", notes, failures)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewNotesManager("bulk").GetNotesBulkWithContext(ctx, shas[:2])
+		var bulkErr *BulkError
+		if !errors.As(err, &bulkErr) || !bulkErr.Only(CategoryCanceled) || !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected canceled lookups, got %v", err)
+		}
+	})
+}
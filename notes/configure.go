@@ -0,0 +1,226 @@
+package notes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RemoteConfigOptions selects the configuration ConfigureRemote adds for each namespace.
+type RemoteConfigOptions struct {
+	// Fetch adds "+<ref>:refs/remotes/<name>/notes/<namespace>" to remote.<name>.fetch, so a plain
+	// `git fetch` keeps the remote-tracking notes ref used by FetchNotes up to date. Local notes refs
+	// are never written by the refspec; FetchNotes merges the remote notes into them.
+	Fetch bool
+	// Push adds "<ref>:<ref>" to remote.<name>.push. Note that once remote.<name>.push is set, a
+	// plain `git push` to that remote pushes only the configured refspecs.
+	Push bool
+	// DisplayRef adds the ref to notes.displayRef, so `git log` shows the notes.
+	DisplayRef bool
+	// RewriteRef adds the ref to notes.rewriteRef, so notes follow commits rewritten by
+	// `git commit --amend` and `git rebase`.
+	RewriteRef bool
+	// Hooks are called before and after each git command run.
+	Hooks CommandHooks
+}
+
+// DefaultRemoteConfigOptions returns the options that make notes available on fresh clones once
+// fetched with FetchNotes: fetch refspecs and notes.displayRef.
+func DefaultRemoteConfigOptions() RemoteConfigOptions {
+	return RemoteConfigOptions{Fetch: true, DisplayRef: true}
+}
+
+// ConfigAction describes what happened to a configuration value.
+type ConfigAction string
+
+const (
+	ConfigAdded   ConfigAction = "added"
+	ConfigPresent ConfigAction = "present"
+	ConfigRemoved ConfigAction = "removed"
+	ConfigAbsent  ConfigAction = "absent"
+)
+
+// ConfigChange is a single multi-valued configuration entry handled by ConfigureRemote or
+// UnconfigureRemote.
+type ConfigChange struct {
+	Key    string
+	Value  string
+	Action ConfigAction
+}
+
+// RemoteConfigReport lists the notes-related configuration of a remote.
+type RemoteConfigReport struct {
+	Remote  string
+	Changes []ConfigChange
+}
+
+// Changed reports whether any configuration was added or removed.
+func (r *RemoteConfigReport) Changed() bool {
+	for _, change := range r.Changes {
+		if change.Action == ConfigAdded || change.Action == ConfigRemoved {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureRemote adds the configuration selected by opts for every namespace, so that plain git
+// commands fetch, push and display the notes. Values that are already configured are left alone,
+// so calling it repeatedly is safe. namespaces may include AllNamespaces.
+func ConfigureRemote(remoteName string, namespaces []string, opts RemoteConfigOptions) (*RemoteConfigReport, error) {
+	ctx := hooksContext("", opts.Hooks)
+	entries, err := remoteConfigEntries(ctx, remoteName, namespaces, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RemoteConfigReport{Remote: remoteName}
+	for _, entry := range entries {
+		present, err := configHasValue(ctx, entry.Key, entry.Value)
+		if err != nil {
+			return report, err
+		}
+		entry.Action = ConfigPresent
+		if !present {
+			if _, stderr, err := executeGitCommandContext(ctx, "config", "--add", entry.Key, entry.Value); err != nil {
+				return report, fmt.Errorf("failed to add %s=%s (stderr: %s): %w", entry.Key, entry.Value, stderr, err)
+			}
+			entry.Action = ConfigAdded
+		}
+		report.Changes = append(report.Changes, entry)
+	}
+	return report, nil
+}
+
+// UnconfigureRemote removes the configuration ConfigureRemote adds for the same arguments. Other
+// values of the same keys are kept.
+func UnconfigureRemote(remoteName string, namespaces []string, opts RemoteConfigOptions) (*RemoteConfigReport, error) {
+	ctx := hooksContext("", opts.Hooks)
+	entries, err := remoteConfigEntries(ctx, remoteName, namespaces, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RemoteConfigReport{Remote: remoteName}
+	for _, entry := range entries {
+		present, err := configHasValue(ctx, entry.Key, entry.Value)
+		if err != nil {
+			return report, err
+		}
+		entry.Action = ConfigAbsent
+		if present {
+			pattern := "^" + regexp.QuoteMeta(entry.Value) + "$"
+			if _, stderr, err := executeGitCommandContext(ctx, "config", "--unset-all", entry.Key, pattern); err != nil {
+				return report, fmt.Errorf("failed to remove %s=%s (stderr: %s): %w", entry.Key, entry.Value, stderr, err)
+			}
+			entry.Action = ConfigRemoved
+		}
+		report.Changes = append(report.Changes, entry)
+	}
+	return report, nil
+}
+
+// RemoteNotesConfig reports the notes refspecs configured for the remote and the configured
+// notes.displayRef and notes.rewriteRef values. Every entry has the action ConfigPresent.
+func RemoteNotesConfig(remoteName string) (*RemoteConfigReport, error) {
+	ctx := context.Background()
+	if err := checkRemoteConfigured(ctx, remoteName); err != nil {
+		return nil, err
+	}
+
+	report := &RemoteConfigReport{Remote: remoteName}
+	for _, key := range []string{"remote." + remoteName + ".fetch", "remote." + remoteName + ".push", "notes.displayRef", "notes.rewriteRef"} {
+		values, err := configValues(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if strings.HasPrefix(key, "notes.") || strings.Contains(value, "refs/notes/") {
+				report.Changes = append(report.Changes, ConfigChange{Key: key, Value: value, Action: ConfigPresent})
+			}
+		}
+	}
+	return report, nil
+}
+
+// remoteConfigEntries lists the configuration values opts selects for namespaces.
+func remoteConfigEntries(ctx context.Context, remoteName string, namespaces []string, opts RemoteConfigOptions) ([]ConfigChange, error) {
+	if err := checkRemoteConfigured(ctx, remoteName); err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("namespaces cannot be empty")
+	}
+
+	var entries []ConfigChange
+	for _, namespace := range namespaces {
+		ref := formatNamespaceRef(namespace)
+		if _, _, err := executeGitCommandContext(ctx, "check-ref-format", "--refspec-pattern", ref); err != nil {
+			return nil, fmt.Errorf("invalid notes namespace '%s': %w", namespace, err)
+		}
+		if opts.Fetch {
+			// The remote notes go where FetchNotes fetches them, so both never race over a ref.
+			trackingRef, err := buildRemoteTrackingRef(Remote{Name: remoteName}, ref)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, ConfigChange{Key: "remote." + remoteName + ".fetch", Value: "+" + ref + ":" + trackingRef})
+		}
+		if opts.Push {
+			entries = append(entries, ConfigChange{Key: "remote." + remoteName + ".push", Value: ref + ":" + ref})
+		}
+		if opts.DisplayRef {
+			entries = append(entries, ConfigChange{Key: "notes.displayRef", Value: ref})
+		}
+		if opts.RewriteRef {
+			entries = append(entries, ConfigChange{Key: "notes.rewriteRef", Value: ref})
+		}
+	}
+	return entries, nil
+}
+
+func checkRemoteConfigured(ctx context.Context, remoteName string) error {
+	if remoteName == "" {
+		return fmt.Errorf("remoteName cannot be empty")
+	}
+	if _, _, err := executeGitCommandContext(ctx, "config", "--get", "remote."+remoteName+".url"); err != nil {
+		return fmt.Errorf("remote '%s' is not configured: %w", remoteName, err)
+	}
+	return nil
+}
+
+// configValues returns all values of a multi-valued configuration key.
+func configValues(ctx context.Context, key string) ([]string, error) {
+	output, stderr, err := executeGitCommandContext(ctx, "config", "--get-all", key)
+	if err != nil {
+		// Exit code 1 means the key is not set.
+		var gitErr *GitCommandError
+		if errors.As(err, &gitErr) && gitErr.ExitCode == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s (stderr: %s): %w", key, stderr, err)
+	}
+
+	var values []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		values = append(values, scanner.Text())
+	}
+	return values, scanner.Err()
+}
+
+func configHasValue(ctx context.Context, key, value string) (bool, error) {
+	values, err := configValues(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range values {
+		if v == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,120 @@
+package notes
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestConfigureRemote(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	manager := NewNotesManager("configured")
+	if err := manager.SetNote(commitSha, "shared note"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	if err := manager.PushNotes("testorigin"); err != nil {
+		t.Fatalf("PushNotes failed: %v", err)
+	}
+
+	pushedTip := refTip(context.Background(), manager.GetRef())
+
+	// Configure the clone, which does not fetch notes by default.
+	chdirForTest(t, clonePath)
+	runCmd(t, clonePath, "git", "config", "--add", "notes.displayRef", "refs/notes/other")
+	opts := RemoteConfigOptions{Fetch: true, Push: true, DisplayRef: true, RewriteRef: true}
+
+	report, err := ConfigureRemote("origin", []string{"configured"}, opts)
+	if err != nil {
+		t.Fatalf("ConfigureRemote failed: %v", err)
+	}
+	if len(report.Changes) != 4 || !report.Changed() {
+		t.Fatalf("Expected 4 added entries, got %+v", report.Changes)
+	}
+	for _, change := range report.Changes {
+		if change.Action != ConfigAdded {
+			t.Errorf("Expected %s to be added, got %s", change.Key, change.Action)
+		}
+	}
+
+	runCmd(t, clonePath, "git", "fetch", "origin")
+	trackingRef := "refs/remotes/origin/notes/configured"
+	if tip, _ := runCmd(t, clonePath, "git", "rev-parse", trackingRef); tip != pushedTip {
+		t.Errorf("Expected a plain fetch to update %s, got %q", trackingRef, tip)
+	}
+	if refTip(context.Background(), manager.GetRef()) != "" {
+		t.Error("Expected a plain fetch to leave the local notes ref alone")
+	}
+	if err := NewNotesManager("configured").FetchNotes("origin"); err != nil {
+		t.Fatalf("FetchNotes failed: %v", err)
+	}
+	if log, _ := runCmd(t, clonePath, "git", "log", "-1", "--format=%N", commitSha); !strings.Contains(log, "shared note") {
+		t.Errorf("Expected git log to display the notes, got %q", log)
+	}
+
+	t.Run("FetchAfterDivergentRemoteWrite", func(t *testing.T) {
+		clone := NewNotesManager("configured")
+		if err := clone.SetNote(commitSha, "clone note"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		// Another writer force-pushes notes that do not descend from the clone's.
+		runCmd(t, localPath, "git", "notes", "--ref", manager.GetRef(), "add", "-f", "-m", "rewritten upstream", commitSha)
+		runCmd(t, localPath, "git", "push", "-f", "testorigin", manager.GetRef())
+
+		runCmd(t, clonePath, "git", "fetch", "origin")
+		if err := clone.FetchNotes("origin"); err != nil {
+			t.Fatalf("FetchNotes with the configured remote failed: %v", err)
+		}
+		note, err := clone.GetNote(commitSha)
+		if err != nil || !strings.Contains(note, "clone note") || !strings.Contains(note, "rewritten upstream") {
+			t.Errorf("Expected the divergent notes to be merged, got %q (%v)", note, err)
+		}
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		report, err := ConfigureRemote("origin", []string{"configured"}, opts)
+		if err != nil || report.Changed() {
+			t.Fatalf("Expected nothing to change, got %+v (%v)", report, err)
+		}
+		if values, _ := configValues(context.Background(), "remote.origin.fetch"); len(values) != 2 {
+			t.Errorf("Expected the default and the notes fetch refspec, got %v", values)
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		report, err := RemoteNotesConfig("origin")
+		if err != nil {
+			t.Fatalf("RemoteNotesConfig failed: %v", err)
+		}
+		// Fetch and push refspecs, two display refs and the rewrite ref.
+		if len(report.Changes) != 5 {
+			t.Errorf("Unexpected status: %+v", report.Changes)
+		}
+	})
+
+	t.Run("Undo", func(t *testing.T) {
+		report, err := UnconfigureRemote("origin", []string{"configured"}, opts)
+		if err != nil {
+			t.Fatalf("UnconfigureRemote failed: %v", err)
+		}
+		for _, change := range report.Changes {
+			if change.Action != ConfigRemoved {
+				t.Errorf("Expected %s to be removed, got %s", change.Key, change.Action)
+			}
+		}
+		if values, _ := configValues(context.Background(), "notes.displayRef"); len(values) != 1 || values[0] != "refs/notes/other" {
+			t.Errorf("Expected unrelated display refs to be kept, got %v", values)
+		}
+		if values, _ := configValues(context.Background(), "remote.origin.fetch"); len(values) != 1 {
+			t.Errorf("Expected only the default fetch refspec, got %v", values)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		if _, err := ConfigureRemote("missing", []string{"configured"}, opts); err == nil {
+			t.Error("Expected an unknown remote to be rejected")
+		}
+		if _, err := ConfigureRemote("origin", []string{"bad..name"}, opts); err == nil {
+			t.Error("Expected an invalid namespace to be rejected")
+		}
+	})
+}
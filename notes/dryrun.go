@@ -0,0 +1,264 @@
+package notes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Plan describes what a mutating operation would do. Managers created with WithDryRun report a
+// Plan for every SetNote, DeleteNote, fetch and push instead of performing it.
+type Plan struct {
+	// Operation is one of "set", "delete", "fetch" or "push".
+	Operation string
+	Ref       string
+	// CommitSha is the resolved annotated object for "set" and "delete".
+	CommitSha string
+	// OldTip is the current local notes tip ("" if the notes ref does not exist).
+	OldTip string
+	// NewTip and Tree are the notes commit and tree the operation would produce. The objects are
+	// written to the object database but not referenced by any ref. NewTip equals OldTip when the
+	// operation would not change the local notes ref.
+	NewTip string
+	Tree   string
+	// Added, Changed and Removed list the annotated objects whose notes would change locally.
+	Added   []string
+	Changed []string
+	Removed []string
+	// RemoteTip is the remote notes tip for "fetch" and "push" ("" if the remote has none).
+	RemoteTip string
+	// Merge is the would-be merge of the remote notes for "fetch" and "push".
+	Merge *MergeResult
+	// Push holds the per-ref status reported by `git push --dry-run --porcelain` for "push".
+	Push []PushRefStatus
+}
+
+// WithDryRun makes the manager validate and plan mutating operations without moving any local or
+// remote refs. Each plan is passed to onPlan, which may be nil. Merges are computed on a scratch
+// notes ref under refs/notes/dry-run-scratch/ that is deleted before the operation returns.
+func WithDryRun(onPlan func(*Plan)) Option {
+	return func(m *notesManager) {
+		m.dryRun = true
+		m.onPlan = onPlan
+	}
+}
+
+func (m *notesManager) reportPlan(plan *Plan) {
+	if m.onPlan != nil {
+		m.onPlan(plan)
+	}
+}
+
+// dryRunNoteUpdate plans a SetNote or DeleteNote and reports the plan.
+func (m *notesManager) dryRunNoteUpdate(commitSha, value string) error {
+	plan, err := m.planNoteUpdate(commitSha, value)
+	if err != nil {
+		return err
+	}
+	m.reportPlan(plan)
+	return nil
+}
+
+// dryRunFetch plans a fetch, reports the plan and describes it as a FetchResult.
+func (m *notesManager) dryRunFetch(remote Remote, force bool) (*FetchResult, error) {
+	plan, err := m.planFetch(remote, force)
+	if err != nil {
+		return nil, err
+	}
+	m.reportPlan(plan)
+
+	result := &FetchResult{
+		Ref:          m.ref,
+		OldLocalTip:  plan.OldTip,
+		NewLocalTip:  plan.NewTip,
+		NewRemoteTip: plan.RemoteTip,
+		Merge:        plan.Merge,
+		Forced:       force,
+	}
+	if !force {
+		result.RemoteTrackingRef, _ = buildRemoteTrackingRef(remote, m.ref)
+		result.OldRemoteTip = refTip(m.gitContext(), result.RemoteTrackingRef)
+	}
+	return result, nil
+}
+
+// dryRunPush plans a push, reports the plan and describes it as a PushResult.
+func (m *notesManager) dryRunPush(remote Remote) (*PushResult, error) {
+	plan, err := m.planPush(remote)
+	if err != nil {
+		return nil, err
+	}
+	m.reportPlan(plan)
+
+	result := &PushResult{
+		Ref:          m.ref,
+		OldLocalTip:  plan.OldTip,
+		NewLocalTip:  plan.NewTip,
+		OldRemoteTip: plan.RemoteTip,
+		Merge:        plan.Merge,
+		Attempts:     1,
+		RefStatuses:  plan.Push,
+	}
+	if len(plan.Push) > 0 && !plan.Push[0].Rejected() {
+		result.NewRemoteTip = plan.NewTip
+	}
+	return result, nil
+}
+
+// planNoteUpdate plans setting (or, if value is empty, removing) the note for commitSha.
+func (m *notesManager) planNoteUpdate(commitSha, value string) (*Plan, error) {
+	plan := &Plan{Operation: "set", Ref: m.ref, OldTip: refTip(m.gitContext(), m.ref)}
+	if value == "" {
+		plan.Operation = "delete"
+	}
+
+	resolved, _, err := m.git("rev-parse", "--verify", "--quiet", commitSha+"^{object}")
+	if err != nil {
+		return nil, &InvalidCommitShaError{CommitSha: commitSha, Err: err}
+	}
+	plan.CommitSha = resolved
+
+	before, err := listNoteBlobs(m.gitContext(), plan.OldTip)
+	if err != nil {
+		return nil, err
+	}
+
+	// The note is written by git on a scratch copy of the notes ref, so that the notes tree gets
+	// the same layout, e.g. fanout directories, as a live update.
+	scratch := newScratchRef()
+	defer deleteScratchRef(m.gitContext(), scratch)
+	if plan.OldTip != "" {
+		if _, stderr, err := m.git("update-ref", scratch, plan.OldTip); err != nil {
+			return nil, fmt.Errorf("failed to create scratch notes ref (stderr: %s): %w", stderr, err)
+		}
+	}
+	args := []string{"notes", "--ref", scratch, "add", "-f", "-m", value, resolved}
+	if value == "" {
+		args = []string{"notes", "--ref", scratch, "remove", "--ignore-missing", resolved}
+	}
+	if _, stderr, err := m.git(args...); err != nil {
+		return nil, fmt.Errorf("failed to plan note update for %s (stderr: %s): %w", resolved, stderr, err)
+	}
+
+	after, err := listNoteBlobs(m.gitContext(), refTip(m.gitContext(), scratch))
+	if err != nil {
+		return nil, err
+	}
+	plan.Added, plan.Changed, plan.Removed = diffNoteBlobs(before, after)
+	plan.NewTip = plan.OldTip
+	if len(plan.Added)+len(plan.Changed)+len(plan.Removed) == 0 {
+		return plan, nil
+	}
+	plan.NewTip = refTip(m.gitContext(), scratch)
+	plan.Tree, _, err = m.git("rev-parse", plan.NewTip+"^{tree}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read planned notes tree: %w", err)
+	}
+	return plan, nil
+}
+
+// newScratchRef returns the name of a new scratch notes ref for a dry run.
+func newScratchRef() string {
+	return fmt.Sprintf("%s%d-%d", scratchRefPrefix, os.Getpid(), time.Now().UnixNano())
+}
+
+func deleteScratchRef(ctx context.Context, ref string) {
+	_, _, _ = executeGitCommandContext(ctx, "update-ref", "-d", ref)
+}
+
+// planFetch fetches the remote notes into a scratch ref and plans how the local notes ref would
+// change, either by merging (the default) or by being overwritten (force).
+func (m *notesManager) planFetch(remote Remote, force bool) (*Plan, error) {
+	plan := &Plan{Operation: "fetch", Ref: m.ref, OldTip: refTip(m.gitContext(), m.ref)}
+	plan.NewTip = plan.OldTip
+
+	// The remote notes are fetched into a scratch ref. --no-write-fetch-head keeps FETCH_HEAD and
+	// an empty --refmap keeps configured refspecs from updating remote-tracking refs.
+	scratch := newScratchRef()
+	defer deleteScratchRef(m.gitContext(), scratch)
+	exists, fetchStderr, fetchErr := remote.fetchRef(m.gitContext(), m.ref, "fetch", "--no-write-fetch-head", "--refmap=", remote.target(), "+"+m.ref+":"+scratch)
+	if fetchErr != nil {
+		return nil, fmt.Errorf("failed to fetch notes from remote '%s' for ref '%s': %w; stderr: %s",
+			remote, m.ref, fetchErr, fetchStderr)
+	}
+	if !exists {
+		return plan, nil
+	}
+	plan.RemoteTip = refTip(m.gitContext(), scratch)
+	if plan.RemoteTip == "" {
+		return plan, nil
+	}
+
+	if force {
+		plan.NewTip = plan.RemoteTip
+	} else {
+		merge, err := m.simulateMerge(plan.OldTip, plan.RemoteTip)
+		if err != nil {
+			return nil, err
+		}
+		plan.Merge = merge
+		plan.NewTip = merge.NewTip
+	}
+
+	if plan.NewTip != plan.OldTip {
+		before, err := listNoteBlobs(m.gitContext(), plan.OldTip)
+		if err != nil {
+			return nil, err
+		}
+		after, err := listNoteBlobs(m.gitContext(), plan.NewTip)
+		if err != nil {
+			return nil, err
+		}
+		plan.Added, plan.Changed, plan.Removed = diffNoteBlobs(before, after)
+		plan.Tree, _, _ = m.git("rev-parse", plan.NewTip+"^{tree}")
+	}
+	return plan, nil
+}
+
+// simulateMerge merges remoteTip into a scratch copy of the local notes ref with the manager's merge
+// strategy and returns the result. The scratch ref is deleted afterwards.
+func (m *notesManager) simulateMerge(localTip, remoteTip string) (*MergeResult, error) {
+	scratch := *m
+	scratch.ref = newScratchRef()
+	defer deleteScratchRef(m.gitContext(), scratch.ref)
+
+	if localTip != "" {
+		if _, stderr, err := m.git("update-ref", scratch.ref, localTip); err != nil {
+			return nil, fmt.Errorf("failed to create scratch notes ref (stderr: %s): %w", stderr, err)
+		}
+	}
+	var merge *MergeResult
+	err := m.withRepoLock(func() error {
+		var err error
+		merge, err = scratch.mergeRemoteNotes(remoteTip)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	merge.OldTip = localTip
+	return merge, nil
+}
+
+// planPush plans a push: the would-be merge of the remote notes and the outcome reported by
+// `git push --dry-run` for the resulting notes tip.
+func (m *notesManager) planPush(remote Remote) (*Plan, error) {
+	plan, err := m.planFetch(remote, false)
+	if err != nil {
+		return nil, err
+	}
+	plan.Operation = "push"
+	if plan.NewTip == "" {
+		return plan, nil
+	}
+
+	refspec := fmt.Sprintf("%s:%s", plan.NewTip, m.ref)
+	pushStdout, pushStderr, pushErr := remote.git(m.gitContext(), "push", "--dry-run", "--porcelain", remote.target(), refspec)
+	plan.Push = parsePushPorcelain(pushStdout)
+	if pushErr != nil && len(plan.Push) == 0 {
+		return nil, fmt.Errorf("failed to dry-run push of notes ref '%s' to remote '%s': %w; stderr: %s",
+			m.ref, remote, pushErr, pushStderr)
+	}
+	return plan, nil
+}
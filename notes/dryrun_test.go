@@ -0,0 +1,156 @@
+package notes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	otherSha := createTestCommit(t, localPath, "dry.txt", "dry", "Dry-run commit")
+
+	var plans []*Plan
+	live := NewNotesManager("planned")
+	dry := NewNotesManager("planned", WithDryRun(func(p *Plan) { plans = append(plans, p) }))
+	if err := live.SetNote(commitSha, "existing"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	tipBefore := refTip(context.Background(), live.GetRef())
+	runCmd(t, localPath, "git", "fetch", "testorigin", "main")
+	fetchHead, err := os.ReadFile(filepath.Join(localPath, ".git", "FETCH_HEAD"))
+	if err != nil {
+		t.Fatalf("Failed to read FETCH_HEAD: %v", err)
+	}
+
+	assertUnchanged := func(t *testing.T) {
+		t.Helper()
+		if tip := refTip(context.Background(), live.GetRef()); tip != tipBefore {
+			t.Fatalf("Dry run moved the notes ref from %s to %s", tipBefore, tip)
+		}
+		if refs, _ := runCmd(t, localPath, "git", "for-each-ref", "refs/notes/dry-run-scratch/", "refs/remotes/testorigin/notes/"); refs != "" {
+			t.Fatalf("Dry run left refs behind:\n%s", refs)
+		}
+		if current, _ := os.ReadFile(filepath.Join(localPath, ".git", "FETCH_HEAD")); string(current) != string(fetchHead) {
+			t.Fatalf("Dry run overwrote FETCH_HEAD:\n%s", current)
+		}
+	}
+
+	t.Run("SetNote", func(t *testing.T) {
+		plans = nil
+		if err := dry.SetNote("", "planned note"); err != nil {
+			t.Fatalf("Dry-run SetNote failed: %v", err)
+		}
+		assertUnchanged(t)
+		if len(plans) != 1 {
+			t.Fatalf("Expected one plan, got %d", len(plans))
+		}
+		plan := plans[0]
+		if plan.Operation != "set" || plan.CommitSha != otherSha || plan.OldTip != tipBefore {
+			t.Errorf("Unexpected plan: %+v", plan)
+		}
+		if !reflect.DeepEqual(plan.Added, []string{otherSha}) || plan.NewTip == "" || plan.NewTip == tipBefore {
+			t.Errorf("Expected the note to be planned as added in a new commit, got %+v", plan)
+		}
+
+		// Applying the plan for live yields the same notes tree.
+		if err := live.SetNote(otherSha, "planned note"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		realTree, _ := runCmd(t, localPath, "git", "rev-parse", live.GetRef()+"^{tree}")
+		if realTree != plan.Tree {
+			t.Errorf("Planned tree %s differs from the live tree %s", plan.Tree, realTree)
+		}
+		runCmd(t, localPath, "git", "update-ref", live.GetRef(), tipBefore)
+	})
+
+	t.Run("DeleteNoteAndValidation", func(t *testing.T) {
+		plans = nil
+		if err := dry.DeleteNote(commitSha); err != nil {
+			t.Fatalf("Dry-run DeleteNote failed: %v", err)
+		}
+		assertUnchanged(t)
+		if len(plans) != 1 || plans[0].Operation != "delete" || !reflect.DeepEqual(plans[0].Removed, []string{commitSha}) {
+			t.Errorf("Unexpected delete plan: %+v", plans)
+		}
+
+		if err := dry.SetNote("abcdef1234", "x"); !IsInvalidCommitSha(err) {
+			t.Errorf("Expected InvalidCommitShaError for unknown commit, got %v", err)
+		}
+		if err := dry.SetNote(commitSha, strings.Repeat("x", MaxNoteSize+1)); !IsNoteSizeExceededError(err) {
+			t.Errorf("Expected NoteSizeExceededError, got %v", err)
+		}
+	})
+
+	t.Run("PushNotes", func(t *testing.T) {
+		pushNoteFromClone(t, clonePath, live.GetRef(), otherSha, "remote note")
+		remoteTip, _ := runCmd(t, clonePath, "git", "rev-parse", live.GetRef())
+
+		plans = nil
+		result, err := dry.PushNotesWithResult("testorigin", DefaultRetryAttempts)
+		if err != nil {
+			t.Fatalf("Dry-run push failed: %v", err)
+		}
+		assertUnchanged(t)
+		lsRemote, _ := runCmd(t, localPath, "git", "ls-remote", "testorigin", live.GetRef())
+		if !strings.HasPrefix(lsRemote, remoteTip) {
+			t.Fatalf("Dry run moved the remote ref: %s", lsRemote)
+		}
+
+		if len(plans) != 1 || plans[0].Operation != "push" {
+			t.Fatalf("Expected one push plan, got %+v", plans)
+		}
+		plan := plans[0]
+		if plan.RemoteTip != remoteTip || plan.Merge == nil || !reflect.DeepEqual(plan.Merge.Added, []string{otherSha}) {
+			t.Errorf("Unexpected merge plan: %+v (merge %+v)", plan, plan.Merge)
+		}
+		if len(plan.Push) != 1 || plan.Push[0].Rejected() || plan.Push[0].To != live.GetRef() {
+			t.Errorf("Expected a fast-forward dry-run push, got %+v", plan.Push)
+		}
+		if result.NewLocalTip != plan.NewTip || result.NewRemoteTip != plan.NewTip {
+			t.Errorf("PushResult does not reflect the plan: %+v", result)
+		}
+	})
+}
+
+func TestDryRunLargeNotesRef(t *testing.T) {
+	repoPath := setupTestRepo(t)
+	chdirForTest(t, repoPath)
+
+	// git stores the notes of a ref holding more than 256 notes in fanout directories.
+	var stream strings.Builder
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&stream, "commit refs/heads/many\nmark :%d\ncommitter A <a@example.com> 0 +0000\ndata 2\n%d\n", i, i%10)
+	}
+	stream.WriteString("commit refs/notes/large\ncommitter A <a@example.com> 0 +0000\ndata 5\nnotes\n")
+	for i := 1; i < 300; i++ {
+		fmt.Fprintf(&stream, "N inline :%d\ndata 5\nnote\n", i)
+	}
+	cmd := exec.Command("git", "fast-import", "--quiet")
+	cmd.Dir = repoPath
+	cmd.Stdin = strings.NewReader(stream.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("fast-import failed: %v\n%s", err, out)
+	}
+	if tree, _ := runCmd(t, repoPath, "git", "ls-tree", "--name-only", "refs/notes/large"); len(strings.Fields(tree)) == 299 {
+		t.Fatal("Expected a notes tree with fanout directories")
+	}
+
+	tip, _ := runCmd(t, repoPath, "git", "rev-parse", "refs/heads/many")
+	var plan *Plan
+	dry := NewNotesManager("large", WithDryRun(func(p *Plan) { plan = p }))
+	if err := dry.SetNote(tip, "planned"); err != nil {
+		t.Fatalf("Dry-run SetNote failed: %v", err)
+	}
+	if err := NewNotesManager("large").SetNote(tip, "planned"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	if realTree, _ := runCmd(t, repoPath, "git", "rev-parse", "refs/notes/large^{tree}"); plan == nil || plan.Tree != realTree {
+		t.Errorf("Planned tree differs from the live tree %s: %+v", realTree, plan)
+	}
+}
@@ -1,20 +1,64 @@
 package notes
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// GitCommandError is returned, usually wrapped, when a git command fails to start, exits with a
+// non-zero status or is cancelled.
+type GitCommandError struct {
+	// Args are the arguments passed to git, including leading `-c key=value` options, with the
+	// values of sensitive options and the credentials of URLs redacted.
+	Args []string
+	// ExitCode is git's exit status, or -1 if git did not exit normally.
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+	// Err is the cause: an *exec.ExitError, an error starting git or the context's error.
+	Err error
+}
+
+func (e *GitCommandError) Error() string {
+	switch {
+	case errors.Is(e.Err, context.Canceled) || errors.Is(e.Err, context.DeadlineExceeded):
+		return fmt.Sprintf("command cancelled: %v", e.Err)
+	case e.ExitCode >= 0:
+		return fmt.Sprintf("git %s failed with exit code %d: %v; stderr: %s", gitSubcommand(e.Args), e.ExitCode, e.Err, e.Stderr)
+	default:
+		return fmt.Sprintf("git %s failed: %v; stderr: %s", gitSubcommand(e.Args), e.Err, e.Stderr)
+	}
+}
+
+func (e *GitCommandError) Unwrap() error {
+	return e.Err
+}
+
+func IsGitCommandError(err error) bool {
+	var nf *GitCommandError
+	return errors.As(err, &nf)
+}
+
 // NoteNotFoundError is returned when a note does not exist for the given commit SHA.
 type NoteNotFoundError struct {
 	Ref       string
 	CommitSha string
+	// Err is the failed git command, if any.
+	Err error
 }
 
 func (e *NoteNotFoundError) Error() string {
 	return "note not found for commit " + e.CommitSha + " in ref " + e.Ref
 }
 
+func (e *NoteNotFoundError) Unwrap() error {
+	return e.Err
+}
+
 func IsNoteNotFound(err error) bool {
 	var nf *NoteNotFoundError
 	return errors.As(err, &nf)
@@ -23,17 +67,57 @@ func IsNoteNotFound(err error) bool {
 // InvalidCommitShaError is returned when the commit SHA does not exist or is invalid.
 type InvalidCommitShaError struct {
 	CommitSha string
+	// Err is the failed git command, if any.
+	Err error
 }
 
 func (e *InvalidCommitShaError) Error() string {
 	return "invalid or non-existent commit SHA: " + e.CommitSha
 }
 
+func (e *InvalidCommitShaError) Unwrap() error {
+	return e.Err
+}
+
 func IsInvalidCommitSha(err error) bool {
 	var nf *InvalidCommitShaError
 	return errors.As(err, &nf)
 }
 
+// NotesRefNotFoundError is returned when the notes ref of a namespace does not exist, i.e. no note
+// has been added to the namespace yet. See WithMissingRefAsEmpty.
+type NotesRefNotFoundError struct {
+	Ref string
+}
+
+func (e *NotesRefNotFoundError) Error() string {
+	return "notes ref " + e.Ref + " does not exist"
+}
+
+func IsNotesRefNotFound(err error) bool {
+	var nf *NotesRefNotFoundError
+	return errors.As(err, &nf)
+}
+
+// NotARepositoryError is returned when the working directory is not inside a git repository.
+type NotARepositoryError struct {
+	Path string
+	Err  error
+}
+
+func (e *NotARepositoryError) Error() string {
+	return "not a git repository: " + e.Path
+}
+
+func (e *NotARepositoryError) Unwrap() error {
+	return e.Err
+}
+
+func IsNotARepository(err error) bool {
+	var nf *NotARepositoryError
+	return errors.As(err, &nf)
+}
+
 // NoteSizeExceededError is returned when a note exceeds the maximum allowed size.
 type NoteSizeExceededError struct {
 	Size    int
@@ -48,3 +132,169 @@ func IsNoteSizeExceededError(err error) bool {
 	var nf *NoteSizeExceededError
 	return errors.As(err, &nf)
 }
+
+// PushQueuedError is returned when a push failed because the remote was unreachable and was queued
+// in the manager's outbox for replay.
+type PushQueuedError struct {
+	Ref    string
+	Remote string
+	// Pending is the number of pushes of Ref waiting in the outbox.
+	Pending int
+	Err     error
+}
+
+func (e *PushQueuedError) Error() string {
+	return fmt.Sprintf("push of %s to %s queued (%d pending): %v", e.Ref, e.Remote, e.Pending, e.Err)
+}
+
+func (e *PushQueuedError) Unwrap() error {
+	return e.Err
+}
+
+func IsPushQueued(err error) bool {
+	var nf *PushQueuedError
+	return errors.As(err, &nf)
+}
+
+// LockTimeoutError is returned when the repository lock could not be acquired in time.
+type LockTimeoutError struct {
+	Path   string
+	Owner  LockOwner
+	Waited time.Duration
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v waiting for lock %s held by pid %d on %s since %s",
+		e.Waited.Round(time.Millisecond), e.Path, e.Owner.PID, e.Owner.Hostname, e.Owner.Acquired.Format(time.RFC3339))
+}
+
+func IsLockTimeout(err error) bool {
+	var nf *LockTimeoutError
+	return errors.As(err, &nf)
+}
+
+// MergeInProgressError is returned when a previous `git notes merge` was not concluded.
+// The merge is left untouched, since it may belong to another process or a user.
+type MergeInProgressError struct {
+	Ref string
+}
+
+func (e *MergeInProgressError) Error() string {
+	return "cannot merge notes into " + e.Ref + ": a previous notes merge has not been concluded " +
+		"(repair it with RecoverState, 'git notes merge --commit' or 'git notes merge --abort')"
+}
+
+func IsMergeInProgress(err error) bool {
+	var nf *MergeInProgressError
+	return errors.As(err, &nf)
+}
+
+// RemoteNotFoundError is returned when the remote is not configured or the repository does not
+// exist on the server.
+type RemoteNotFoundError struct {
+	Remote string
+	Err    error
+}
+
+func (e *RemoteNotFoundError) Error() string {
+	return fmt.Sprintf("remote %s not found: %v", e.Remote, e.Err)
+}
+
+func (e *RemoteNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func IsRemoteNotFound(err error) bool {
+	var nf *RemoteNotFoundError
+	return errors.As(err, &nf)
+}
+
+// AuthenticationError is returned when the remote refused the credentials, or none were available.
+type AuthenticationError struct {
+	Remote string
+	Err    error
+}
+
+func (e *AuthenticationError) Error() string {
+	return fmt.Sprintf("authentication to remote %s failed: %v", e.Remote, e.Err)
+}
+
+func (e *AuthenticationError) Unwrap() error {
+	return e.Err
+}
+
+func IsAuthenticationError(err error) bool {
+	var nf *AuthenticationError
+	return errors.As(err, &nf)
+}
+
+// NetworkError is returned when the remote could not be reached or the connection failed or timed
+// out. Network errors are retryable.
+type NetworkError struct {
+	Remote string
+	Err    error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("network error talking to remote %s: %v", e.Remote, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+func IsNetworkError(err error) bool {
+	var nf *NetworkError
+	return errors.As(err, &nf)
+}
+
+// PushRejectedError is returned when the remote refused to update notes refs, typically because
+// it has notes the push did not include. Rejected pushes are retryable.
+type PushRejectedError struct {
+	Remote string
+	// Rejected holds the rejected refs as reported by `git push --porcelain`.
+	Rejected []PushRefStatus
+	Err      error
+}
+
+func (e *PushRejectedError) Error() string {
+	refs := make([]string, 0, len(e.Rejected))
+	for _, status := range e.Rejected {
+		refs = append(refs, fmt.Sprintf("%s (%s)", status.To, status.Reason))
+	}
+	return fmt.Sprintf("push to %s rejected for %s: %v", e.Remote, strings.Join(refs, ", "), e.Err)
+}
+
+func (e *PushRejectedError) Unwrap() error {
+	return e.Err
+}
+
+func IsPushRejected(err error) bool {
+	var nf *PushRejectedError
+	return errors.As(err, &nf)
+}
+
+// MergeConflictError is returned when remote notes could not be merged into the local notes
+// automatically. The local notes ref is left as it was before the merge.
+type MergeConflictError struct {
+	Ref       string
+	RemoteRef string
+	Strategy  MergeStrategy
+	// Conflicts lists the annotated objects whose local and remote notes conflict.
+	Conflicts []string
+	Err       error
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("failed to automatically merge notes from '%s' into '%s' using '%s', conflict on %s: %v",
+		e.RemoteRef, e.Ref, e.Strategy, strings.Join(e.Conflicts, ", "), e.Err)
+}
+
+func (e *MergeConflictError) Unwrap() error {
+	return e.Err
+}
+
+func IsMergeConflict(err error) bool {
+	var nf *MergeConflictError
+	return errors.As(err, &nf)
+}
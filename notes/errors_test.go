@@ -0,0 +1,179 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGitCommandError(t *testing.T) {
+	repoPath := setupTestRepo(t)
+	commitSha := createTestCommit(t, repoPath, "file.txt", "content", "Commit")
+	chdirForTest(t, repoPath)
+	manager := NewNotesManager("errors")
+
+	t.Run("NoteNotFound", func(t *testing.T) {
+		_, err := manager.GetNote(commitSha)
+		var gitErr *GitCommandError
+		if !IsNoteNotFound(err) || !errors.As(err, &gitErr) {
+			t.Fatalf("Expected a NoteNotFoundError wrapping a GitCommandError, got %v", err)
+		}
+		if gitErr.ExitCode != 1 || gitErr.Args[0] != "notes" || gitErr.Args[len(gitErr.Args)-1] != commitSha {
+			t.Errorf("Unexpected command error: %+v", gitErr)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Error("Expected the exit error to be unwrapped")
+		}
+	})
+
+	t.Run("Push", func(t *testing.T) {
+		if err := manager.SetNote(commitSha, "note"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		_, err := manager.PushNotesTo(RemoteURL(repoPath+"/missing"), 1)
+		var gitErr *GitCommandError
+		if !errors.As(err, &gitErr) {
+			t.Fatalf("Expected a wrapped GitCommandError, got %v", err)
+		}
+		if gitErr.ExitCode != 128 || gitErr.Stderr == "" || gitErr.Duration <= 0 {
+			t.Errorf("Unexpected command error: %+v", gitErr)
+		}
+		if !strings.Contains(err.Error(), "exit code 128") {
+			t.Errorf("Expected the exit code in the message, got %q", err)
+		}
+	})
+
+	t.Run("RedactsArgs", func(t *testing.T) {
+		remote := Remote{URL: repoPath + "/missing", Config: map[string]string{"http.extraHeader": "Authorization: Bearer secret"}}
+		_, err := manager.PushNotesTo(remote, 1)
+		var gitErr *GitCommandError
+		if !errors.As(err, &gitErr) {
+			t.Fatalf("Expected a wrapped GitCommandError, got %v", err)
+		}
+		if !slices.Contains(gitErr.Args, "http.extraHeader=REDACTED") {
+			t.Errorf("Expected the header override to be redacted, got %v", gitErr.Args)
+		}
+		if details := fmt.Sprintf("%v %+v", err, gitErr); strings.Contains(details, "secret") {
+			t.Errorf("Expected no credentials in the error, got %s", details)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := executeGitCommandContext(ctx, "status")
+		var gitErr *GitCommandError
+		if !errors.As(err, &gitErr) || !errors.Is(err, context.Canceled) || gitErr.ExitCode != -1 {
+			t.Errorf("Expected a cancelled GitCommandError, got %v", err)
+		}
+	})
+}
+
+func TestRemoteAndMergeErrors(t *testing.T) {
+	_, remotePath, clonePath, commitSha := setupRemoteTestRepos(t)
+	manager := NewNotesManager("typed-errors")
+	if err := manager.SetNote(commitSha, "local"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	// sshRemote fakes an ssh transport that fails with the given message.
+	sshRemote := func(message string) Remote {
+		return Remote{
+			URL: "ssh://git@example.invalid/repo.git",
+			Env: []string{"GIT_SSH_COMMAND=echo '" + message + "' >&2; false"},
+		}
+	}
+
+	t.Run("RemoteNotFound", func(t *testing.T) {
+		err := manager.PushNotes("nonexistentremote")
+		if !IsRemoteNotFound(err) || IsNetworkError(err) || IsRetryableError(err) {
+			t.Errorf("Expected a non-retryable RemoteNotFoundError, got %v", err)
+		}
+	})
+
+	t.Run("Authentication", func(t *testing.T) {
+		_, err := manager.PushNotesTo(sshRemote("git@example.invalid: Permission denied (publickey)."), 1)
+		if !IsAuthenticationError(err) || IsRetryableError(err) || !IsGitCommandError(err) {
+			t.Errorf("Expected an AuthenticationError, got %v", err)
+		}
+	})
+
+	t.Run("Network", func(t *testing.T) {
+		_, err := manager.PushNotesTo(sshRemote("ssh: connect to host example.invalid port 22: Connection refused"), 1)
+		if !IsNetworkError(err) || !IsRetryableError(err) {
+			t.Errorf("Expected a retryable NetworkError, got %v", err)
+		}
+	})
+
+	t.Run("PushRejected", func(t *testing.T) {
+		hook := filepath.Join(remotePath, "hooks", "pre-receive")
+		if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+			t.Fatalf("Failed to write hook: %v", err)
+		}
+		defer os.Remove(hook)
+
+		_, err := manager.PushNotesTo(NamedRemote("testorigin"), 1)
+		var rejected *PushRejectedError
+		if !errors.As(err, &rejected) || !IsRetryableError(err) {
+			t.Fatalf("Expected a retryable PushRejectedError, got %v", err)
+		}
+		if len(rejected.Rejected) != 1 || rejected.Rejected[0].To != manager.GetRef() || rejected.Rejected[0].Reason != "pre-receive hook declined" {
+			t.Errorf("Unexpected rejected refs: %+v", rejected.Rejected)
+		}
+	})
+
+	t.Run("MergeConflict", func(t *testing.T) {
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+		before := refTip(context.Background(), manager.GetRef())
+		_, err := NewNotesManager("typed-errors", WithMergeStrategy(MergeManual)).FetchNotesMerge("testorigin")
+		var conflict *MergeConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("Expected a MergeConflictError, got %v", err)
+		}
+		if len(conflict.Conflicts) != 1 || conflict.Conflicts[0] != commitSha || conflict.Strategy != MergeManual {
+			t.Errorf("Unexpected conflict: %+v", conflict)
+		}
+		if refTip(context.Background(), manager.GetRef()) != before {
+			t.Error("Expected the merge to be rolled back")
+		}
+	})
+}
+
+func TestNotesRefErrors(t *testing.T) {
+	repoPath := setupTestRepo(t)
+	commitSha := createTestCommit(t, repoPath, "file.txt", "content", "Commit")
+	chdirForTest(t, repoPath)
+
+	t.Run("BrokenRef", func(t *testing.T) {
+		refPath := filepath.Join(repoPath, ".git", "refs", "notes", "broken")
+		if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(refPath, []byte("garbage\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		list, err := NewNotesManager("broken", WithMissingRefAsEmpty()).GetNoteList()
+		if err == nil || IsNotesRefNotFound(err) {
+			t.Errorf("Expected a broken ref to be reported, got %v (%v)", list, err)
+		}
+	})
+
+	t.Run("NotARepository", func(t *testing.T) {
+		chdirForTest(t, t.TempDir())
+		// Keep git from finding a repository above the temporary directory.
+		t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(t.TempDir()))
+		manager := NewNotesManager("missing", WithMissingRefAsEmpty())
+		if _, err := manager.GetNoteList(); !IsNotARepository(err) {
+			t.Errorf("Expected NotARepositoryError from GetNoteList, got %v", err)
+		}
+		if _, err := manager.GetNote(commitSha); !IsNotARepository(err) {
+			t.Errorf("Expected NotARepositoryError from GetNote, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package notes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NoteOperation is the kind of change made to a note by a notes commit.
+type NoteOperation string
+
+const (
+	NoteAdded    NoteOperation = "add"
+	NoteModified NoteOperation = "modify"
+	NoteRemoved  NoteOperation = "remove"
+)
+
+// Signature identifies the author or committer of a notes commit.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// NoteChange is a change made to the note of one commit by a commit of a notes ref.
+type NoteChange struct {
+	// NotesCommit is the commit of the notes ref that made the change.
+	NotesCommit string
+	Author      Signature
+	Committer   Signature
+	// Target is the SHA of the annotated commit.
+	Target    string
+	Operation NoteOperation
+	// OldBlob and NewBlob are the note blobs before and after the change ("" if absent).
+	OldBlob string
+	NewBlob string
+}
+
+// AuditLogOptions select the changes reported by AuditLog. The zero value reports every change of
+// the default notes ref.
+type AuditLogOptions struct {
+	// Namespace is the notes ref, as passed to NewNotesManager.
+	Namespace string
+	// Target keeps the changes to the note of this commit, given by SHA or any revision git resolves.
+	Target string
+	// Author keeps the changes whose author name or email contains it, ignoring case.
+	Author string
+	// Since and Until keep the changes committed in [Since, Until). Zero values are unbounded.
+	Since time.Time
+	Until time.Time
+	// Hooks are called before and after each git command run.
+	Hooks CommandHooks
+}
+
+// AuditLog walks the history of a notes ref and returns the changes made to notes by its commits,
+// newest first. A merge commit only reports the notes it changed relative to all of its parents,
+// e.g. resolved conflicts, since the other changes are reported by the merged commits.
+// It returns NotesRefNotFoundError if the notes ref does not exist.
+func AuditLog(opts AuditLogOptions) ([]NoteChange, error) {
+	ref := formatNamespaceRef(opts.Namespace)
+	ctx := hooksContext(ref, opts.Hooks)
+	exists, err := verifyRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &NotesRefNotFoundError{Ref: ref}
+	}
+
+	// Notes of commits missing from the repository are matched by their full SHA.
+	target := strings.ToLower(opts.Target)
+	if target != "" {
+		resolved, _, err := executeGitCommandContext(ctx, "rev-parse", "--verify", "--quiet", opts.Target+"^{object}")
+		if err == nil {
+			target = resolved
+		}
+	}
+
+	// Each commit starts with a NUL byte followed by its fields separated by unit separators and
+	// its raw diff. Rename detection is disabled since a moved note blob is a note of another commit.
+	output, stderr, err := executeGitCommandContext(ctx, "log", "--root", "-c", "--raw", "--no-abbrev", "--no-renames",
+		"--format=%x00%H%x1f%an%x1f%ae%x1f%aI%x1f%cn%x1f%ce%x1f%cI", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the history of %s (stderr: %s): %w", ref, stderr, err)
+	}
+
+	var changes []NoteChange
+	for _, entry := range strings.Split(output, "\x00")[1:] {
+		header, raw, _ := strings.Cut(entry, "\n")
+		commit, err := parseNotesCommit(header)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.Since.IsZero() && commit.Committer.When.Before(opts.Since) ||
+			!opts.Until.IsZero() && !commit.Committer.When.Before(opts.Until) ||
+			opts.Author != "" && !strings.Contains(strings.ToLower(commit.Author.String()), strings.ToLower(opts.Author)) {
+			continue
+		}
+		for _, line := range strings.Split(raw, "\n") {
+			change, ok := parseRawNoteChange(line)
+			if !ok || target != "" && change.Target != target {
+				continue
+			}
+			change.NotesCommit = commit.NotesCommit
+			change.Author = commit.Author
+			change.Committer = commit.Committer
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// parseNotesCommit parses the header line of a commit printed by AuditLog.
+func parseNotesCommit(header string) (NoteChange, error) {
+	fields := strings.Split(header, "\x1f")
+	if len(fields) != 7 {
+		return NoteChange{}, fmt.Errorf("unexpected git log output: %q", header)
+	}
+	authorTime, err := time.Parse(time.RFC3339, fields[3])
+	if err != nil {
+		return NoteChange{}, fmt.Errorf("unexpected author date %q: %w", fields[3], err)
+	}
+	committerTime, err := time.Parse(time.RFC3339, fields[6])
+	if err != nil {
+		return NoteChange{}, fmt.Errorf("unexpected committer date %q: %w", fields[6], err)
+	}
+	return NoteChange{
+		NotesCommit: fields[0],
+		Author:      Signature{Name: fields[1], Email: fields[2], When: authorTime},
+		Committer:   Signature{Name: fields[4], Email: fields[5], When: committerTime},
+	}, nil
+}
+
+// parseRawNoteChange parses a line of `git log --raw` output, e.g.
+// ":100644 100644 <old> <new> M\tab/cdef..." or, for merges, "::100644 100644 100644 <p1> <p2> <new> MM\t...",
+// comparing with the first parent. It reports false for other lines and for paths that are not notes.
+func parseRawNoteChange(line string) (NoteChange, bool) {
+	meta, path, ok := strings.Cut(line, "\t")
+	if !ok || !strings.HasPrefix(meta, ":") {
+		return NoteChange{}, false
+	}
+	parents := len(meta) - len(strings.TrimLeft(meta, ":"))
+	fields := strings.Fields(meta[parents:])
+	// parents+1 modes, parents+1 blobs and the status.
+	if len(fields) != 2*(parents+1)+1 {
+		return NoteChange{}, false
+	}
+	oldBlob, newBlob := blobOrEmpty(fields[parents+1]), blobOrEmpty(fields[2*parents+1])
+	target := strings.ReplaceAll(path, "/", "")
+	if oldBlob == newBlob || validateCommitSHA(target) != nil {
+		return NoteChange{}, false
+	}
+
+	change := NoteChange{Target: target, Operation: NoteModified, OldBlob: oldBlob, NewBlob: newBlob}
+	switch {
+	case oldBlob == "":
+		change.Operation = NoteAdded
+	case newBlob == "":
+		change.Operation = NoteRemoved
+	}
+	return change, true
+}
+
+// blobOrEmpty returns blob, or "" for the all-zero object name git prints for missing files.
+func blobOrEmpty(blob string) string {
+	if strings.Trim(blob, "0") == "" {
+		return ""
+	}
+	return blob
+}
@@ -0,0 +1,165 @@
+package notes
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	otherSha := createTestCommit(t, localPath, "other.txt", "other", "Other commit")
+	manager := NewNotesManager("history")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// at makes the following commits happen on the given day after day.
+	at := func(days int) {
+		date := day.AddDate(0, 0, days).Format(time.RFC3339)
+		t.Setenv("GIT_AUTHOR_DATE", date)
+		t.Setenv("GIT_COMMITTER_DATE", date)
+	}
+
+	at(0)
+	if err := manager.SetNote(commitSha, "v1"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	at(1)
+	if err := manager.SetNote(commitSha, "v2"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	at(2)
+	runCmd(t, localPath, "git", "-c", "user.name=By Hand", "-c", "user.email=hand@example.com",
+		"notes", "--ref", manager.GetRef(), "add", "-m", "by hand", otherSha)
+	at(3)
+	bot := NewNotesManager("history", WithIdentity("Build Bot", "bot@example.com"))
+	if err := bot.DeleteNote(otherSha); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+
+	t.Run("AllChanges", func(t *testing.T) {
+		changes, err := AuditLog(AuditLogOptions{Namespace: "history"})
+		if err != nil {
+			t.Fatalf("AuditLog failed: %v", err)
+		}
+		want := []struct {
+			target    string
+			operation NoteOperation
+			author    string
+		}{
+			{otherSha, NoteRemoved, "Build Bot"},
+			{otherSha, NoteAdded, "By Hand"},
+			{commitSha, NoteModified, "Test User"},
+			{commitSha, NoteAdded, "Test User"},
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("Expected %d changes, got %+v", len(want), changes)
+		}
+		for i, w := range want {
+			c := changes[i]
+			if c.Target != w.target || c.Operation != w.operation || c.Author.Name != w.author {
+				t.Errorf("Change %d: expected %s of %s by %s, got %+v", i, w.operation, w.target, w.author, c)
+			}
+		}
+		// The manager's changes are made by the identity configured in git, unless it has its own.
+		if changes[3].Author.Email != "test@example.com" || changes[3].Committer.Name != "Test User" {
+			t.Errorf("Expected the configured identity, got %+v", changes[3])
+		}
+		if changes[0].Author.Email != "bot@example.com" || changes[0].Committer.Name != "Build Bot" {
+			t.Errorf("Expected the manager's identity, got %+v", changes[0])
+		}
+		if v1, _ := readNoteBlob(context.Background(), changes[2].OldBlob); v1 != "v1" {
+			t.Errorf("Expected the old blob to hold v1, got %q", v1)
+		}
+		if v2, _ := readNoteBlob(context.Background(), changes[2].NewBlob); v2 != "v2" || changes[2].OldBlob != changes[3].NewBlob {
+			t.Errorf("Unexpected blobs: %+v", changes[2])
+		}
+		if changes[0].NewBlob != "" || changes[3].OldBlob != "" || !changes[1].Committer.When.Equal(day.AddDate(0, 0, 2)) {
+			t.Errorf("Unexpected changes: %+v", changes)
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		changes, err := AuditLog(AuditLogOptions{Namespace: "history", Target: "HEAD"})
+		if err != nil || len(changes) != 2 || changes[0].Target != otherSha {
+			t.Errorf("Expected the changes to the HEAD note, got %+v (%v)", changes, err)
+		}
+		changes, _ = AuditLog(AuditLogOptions{Namespace: "history", Author: "hand@EXAMPLE"})
+		if len(changes) != 1 || changes[0].Operation != NoteAdded || changes[0].Target != otherSha {
+			t.Errorf("Expected the change made by hand, got %+v", changes)
+		}
+		changes, _ = AuditLog(AuditLogOptions{Namespace: "history", Since: day.AddDate(0, 0, 1), Until: day.AddDate(0, 0, 3)})
+		if len(changes) != 2 || changes[0].Operation != NoteAdded || changes[1].Operation != NoteModified {
+			t.Errorf("Expected the changes of days 1 and 2, got %+v", changes)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		at(4)
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+		at(5)
+		if _, err := manager.FetchNotesMerge("testorigin"); err != nil {
+			t.Fatalf("FetchNotesMerge failed: %v", err)
+		}
+		changes, err := AuditLog(AuditLogOptions{Namespace: "history", Target: commitSha})
+		if err != nil {
+			t.Fatalf("AuditLog failed: %v", err)
+		}
+		// The merge resolved the conflict, and the remote note was added from the clone.
+		if len(changes) != 4 || changes[0].Operation != NoteModified || !changes[0].Committer.When.Equal(day.AddDate(0, 0, 5)) {
+			t.Fatalf("Expected the merge to report the resolved note, got %+v", changes)
+		}
+		if changes[1].Operation != NoteAdded || changes[1].Author.Name != "Test User" {
+			t.Errorf("Expected the note added in the clone, got %+v", changes[1])
+		}
+		if changes[0].OldBlob != changes[2].NewBlob {
+			t.Errorf("Expected the merge to be compared with the local note, got %+v", changes[0])
+		}
+	})
+
+	t.Run("MissingRef", func(t *testing.T) {
+		if _, err := AuditLog(AuditLogOptions{Namespace: "missing"}); !IsNotesRefNotFound(err) {
+			t.Errorf("Expected NotesRefNotFoundError, got %v", err)
+		}
+	})
+}
+
+func TestSetNoteWithoutConfiguredIdentity(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL", "EMAIL"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	repoPath := t.TempDir()
+	runCmd(t, repoPath, "git", "init", "-b", "main")
+	runCmd(t, repoPath, "git", "-c", "user.name=Committer", "-c", "user.email=committer@example.com",
+		"commit", "--allow-empty", "-m", "Initial commit")
+	commitSha, _ := runCmd(t, repoPath, "git", "rev-parse", "HEAD")
+	chdirForTest(t, repoPath)
+
+	manager := NewNotesManager("identity")
+	if err := manager.SetNote(commitSha, "note"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	changes, err := AuditLog(AuditLogOptions{Namespace: "identity"})
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Expected one change, got %+v (%v)", changes, err)
+	}
+	// Git makes up an identity from the user and hostname unless the hostname has no domain.
+	if exec.Command("git", "var", "GIT_AUTHOR_IDENT").Run() != nil && changes[0].Author.Name != "Library Notes" {
+		t.Errorf("Expected the library identity, got %+v", changes[0].Author)
+	}
+
+	bot := NewNotesManager("identity", WithIdentity("Build Bot", "bot@example.com"))
+	if err := bot.SetNote(commitSha, "bot note"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	if changes, _ := AuditLog(AuditLogOptions{Namespace: "identity"}); len(changes) != 2 || changes[0].Author.Email != "bot@example.com" {
+		t.Errorf("Expected the manager's identity to override the fallback, got %+v", changes)
+	}
+}
@@ -0,0 +1,159 @@
+package notes
+
+import "context"
+
+// managerCall describes a call of a NotesManager method to the decorator instrumenting it.
+type managerCall struct {
+	operation string
+	// remote is the remote a fetch or push talks to, "" for local calls.
+	remote string
+	// shas is the number of annotated objects the call was given.
+	shas int
+}
+
+// callInstrumenter starts instrumenting a call whose parent context is ctx. It returns the context
+// the wrapped manager runs the call with and the function reporting the end of the call, which may
+// be nil. end is given the value returned by the call, or the note written for SetNote, and the
+// call's error.
+type callInstrumenter func(ctx context.Context, call managerCall) (_ context.Context, end func(result any, err error))
+
+// instrumentedNotesManager is the decorator behind NewObservedNotesManager,
+// NewTracedNotesManager, NewMeteredNotesManager and NewAuditedNotesManager. Every call except
+// GetRef is run through instrumentCall.
+type instrumentedNotesManager struct {
+	NotesManager
+	instrument callInstrumenter
+	ctx        context.Context
+}
+
+func (m *instrumentedNotesManager) withContext(ctx context.Context) NotesManager {
+	bound := *m
+	bound.ctx = ctx
+	return &bound
+}
+
+// instrumentCall runs fn, a call of the manager wrapped by m, with the context returned by m's
+// instrumenter for parent and reports the end of the call. Calls without a context argument pass
+// the context m is bound to as parent and bind the wrapped manager to the context fn is given.
+func instrumentCall[T any](m *instrumentedNotesManager, parent context.Context, call managerCall, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, end := m.instrument(callContext(parent), call)
+	result, err := fn(ctx)
+	if end != nil {
+		end(result, err)
+	}
+	return result, err
+}
+
+func (m *instrumentedNotesManager) GetNote(commitSha string) (string, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "GetNote", shas: 1}, func(ctx context.Context) (string, error) {
+		return bindContext(m.NotesManager, ctx).GetNote(commitSha)
+	})
+}
+
+func (m *instrumentedNotesManager) GetNoteWithContext(ctx context.Context, commitSha string) (string, error) {
+	return instrumentCall(m, ctx, managerCall{operation: "GetNoteWithContext", shas: 1}, func(ctx context.Context) (string, error) {
+		return m.NotesManager.GetNoteWithContext(ctx, commitSha)
+	})
+}
+
+func (m *instrumentedNotesManager) GetNotesBulk(commitShas []string) (map[string]string, map[string]error) {
+	var errs map[string]error
+	notes, _ := instrumentCall(m, m.ctx, managerCall{operation: "GetNotesBulk", shas: len(commitShas)}, func(ctx context.Context) (map[string]string, error) {
+		var notes map[string]string
+		notes, errs = bindContext(m.NotesManager, ctx).GetNotesBulk(commitShas)
+		return notes, newBulkError("get notes", len(commitShas), errs)
+	})
+	return notes, errs
+}
+
+func (m *instrumentedNotesManager) GetNotesBulkWithContext(ctx context.Context, commitShas []string) (map[string]string, error) {
+	return instrumentCall(m, ctx, managerCall{operation: "GetNotesBulkWithContext", shas: len(commitShas)}, func(ctx context.Context) (map[string]string, error) {
+		return m.NotesManager.GetNotesBulkWithContext(ctx, commitShas)
+	})
+}
+
+func (m *instrumentedNotesManager) SetNote(commitSha, value string) error {
+	_, err := instrumentCall(m, m.ctx, managerCall{operation: "SetNote", shas: 1}, func(ctx context.Context) (string, error) {
+		return value, bindContext(m.NotesManager, ctx).SetNote(commitSha, value)
+	})
+	return err
+}
+
+func (m *instrumentedNotesManager) GetNoteList() ([]string, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "GetNoteList"}, func(ctx context.Context) ([]string, error) {
+		return bindContext(m.NotesManager, ctx).GetNoteList()
+	})
+}
+
+func (m *instrumentedNotesManager) DeleteNote(commitSha string) error {
+	_, err := instrumentCall(m, m.ctx, managerCall{operation: "DeleteNote", shas: 1}, func(ctx context.Context) (any, error) {
+		return nil, bindContext(m.NotesManager, ctx).DeleteNote(commitSha)
+	})
+	return err
+}
+
+func (m *instrumentedNotesManager) FetchNotes(remoteName string) error {
+	_, err := instrumentCall(m, m.ctx, managerCall{operation: "FetchNotes", remote: remoteName}, func(ctx context.Context) (any, error) {
+		return nil, bindContext(m.NotesManager, ctx).FetchNotes(remoteName)
+	})
+	return err
+}
+
+func (m *instrumentedNotesManager) FetchNotesMerge(remoteName string) (*MergeResult, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "FetchNotesMerge", remote: remoteName}, func(ctx context.Context) (*MergeResult, error) {
+		return bindContext(m.NotesManager, ctx).FetchNotesMerge(remoteName)
+	})
+}
+
+func (m *instrumentedNotesManager) FetchNotesWithResult(remoteName string) (*FetchResult, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "FetchNotesWithResult", remote: remoteName}, func(ctx context.Context) (*FetchResult, error) {
+		return bindContext(m.NotesManager, ctx).FetchNotesWithResult(remoteName)
+	})
+}
+
+func (m *instrumentedNotesManager) FetchNotesFrom(remote Remote) (*FetchResult, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "FetchNotesFrom", remote: remote.String()}, func(ctx context.Context) (*FetchResult, error) {
+		return bindContext(m.NotesManager, ctx).FetchNotesFrom(remote)
+	})
+}
+
+func (m *instrumentedNotesManager) PushNotes(remoteName string) error {
+	_, err := instrumentCall(m, m.ctx, managerCall{operation: "PushNotes", remote: remoteName}, func(ctx context.Context) (any, error) {
+		return nil, bindContext(m.NotesManager, ctx).PushNotes(remoteName)
+	})
+	return err
+}
+
+// PushNotesWithRetry calls PushNotesWithResult on the wrapped manager, so that the instrumenter is
+// given the result of the push.
+func (m *instrumentedNotesManager) PushNotesWithRetry(remoteName string, maxRetries int) error {
+	_, err := instrumentCall(m, m.ctx, managerCall{operation: "PushNotesWithRetry", remote: remoteName}, func(ctx context.Context) (*PushResult, error) {
+		return bindContext(m.NotesManager, ctx).PushNotesWithResult(remoteName, maxRetries)
+	})
+	return err
+}
+
+func (m *instrumentedNotesManager) PushNotesWithResult(remoteName string, maxRetries int) (*PushResult, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "PushNotesWithResult", remote: remoteName}, func(ctx context.Context) (*PushResult, error) {
+		return bindContext(m.NotesManager, ctx).PushNotesWithResult(remoteName, maxRetries)
+	})
+}
+
+func (m *instrumentedNotesManager) PushNotesTo(remote Remote, maxRetries int) (*PushResult, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "PushNotesTo", remote: remote.String()}, func(ctx context.Context) (*PushResult, error) {
+		return bindContext(m.NotesManager, ctx).PushNotesTo(remote, maxRetries)
+	})
+}
+
+func (m *instrumentedNotesManager) FlushPending() error {
+	_, err := instrumentCall(m, m.ctx, managerCall{operation: "FlushPending"}, func(ctx context.Context) (any, error) {
+		return nil, bindContext(m.NotesManager, ctx).FlushPending()
+	})
+	return err
+}
+
+func (m *instrumentedNotesManager) PendingPushes() ([]PendingPush, error) {
+	return instrumentCall(m, m.ctx, managerCall{operation: "PendingPushes"}, func(ctx context.Context) ([]PendingPush, error) {
+		return bindContext(m.NotesManager, ctx).PendingPushes()
+	})
+}
@@ -0,0 +1,158 @@
+package notes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// JSONMergeFunc returns a MergeFunc for notes written with SetNoteJSON.
+// All sides of a conflicting note are decoded as streams of concatenated JSON values
+// (as GetNoteJSON does) and merged three-way against base, one canonical JSON value per line.
+//
+// If identityKey is empty, values are deduplicated by their canonical form, so objects that only
+// differ in key order or whitespace are considered equal. Otherwise objects are deduplicated by the
+// value at identityKey (a dot-separated path such as "id" or "test.name"), with the local object
+// winning over the remote one unless only the remote side changed it; values without that key fall
+// back to their canonical form. A value removed on one side and unchanged on the other stays removed,
+// while a value removed on one side and changed on the other is kept.
+// The merged stream is sorted, so the result does not depend on which side merged first.
+func JSONMergeFunc(identityKey string) MergeFunc {
+	return func(sha string, local, remote, base string) (string, error) {
+		sides := make(map[string]map[string]string, 3)
+		for _, side := range []struct{ name, content string }{{"base", base}, {"remote", remote}, {"local", local}} {
+			values, err := decodeJSONSide(side.content, identityKey)
+			if err != nil {
+				return "", fmt.Errorf("failed to decode %s JSON note for %s: %w", side.name, sha, err)
+			}
+			sides[side.name] = values
+		}
+
+		merged := make(map[string]string)
+		for _, side := range []string{"local", "remote"} {
+			for key := range sides[side] {
+				if value, ok := mergeJSONValue(sides["local"], sides["remote"], sides["base"], key); ok {
+					merged[key] = value
+				}
+			}
+		}
+
+		if len(merged) > MaxJSONObjects {
+			return "", fmt.Errorf("merged note for %s exceeds maximum number of JSON objects (%d)", sha, MaxJSONObjects)
+		}
+
+		keys := make([]string, 0, len(merged))
+		for key := range merged {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var out strings.Builder
+		for i, key := range keys {
+			if i > 0 {
+				out.WriteByte('\n')
+			}
+			out.WriteString(merged[key])
+		}
+		return out.String(), nil
+	}
+}
+
+// mergeJSONValue resolves the value stored under key from the local, remote and base sides.
+// It reports false when the value is dropped from the merged note.
+func mergeJSONValue(local, remote, base map[string]string, key string) (string, bool) {
+	localValue, inLocal := local[key]
+	remoteValue, inRemote := remote[key]
+	baseValue, inBase := base[key]
+	switch {
+	case inLocal && inRemote:
+		if inBase && localValue == baseValue {
+			return remoteValue, true
+		}
+		return localValue, true
+	case inLocal:
+		// Removed remotely: keep the value only if it is new or was changed locally.
+		return localValue, !inBase || localValue != baseValue
+	case inRemote:
+		return remoteValue, !inBase || remoteValue != baseValue
+	}
+	return "", false
+}
+
+// decodeJSONSide decodes one side of a JSON note into its canonical values keyed by identity.
+// Later values win over earlier ones sharing the same identity.
+func decodeJSONSide(content, identityKey string) (map[string]string, error) {
+	values, err := decodeJSONStream(content)
+	if err != nil {
+		return nil, err
+	}
+	side := make(map[string]string, len(values))
+	for _, value := range values {
+		canonical, err := canonicalJSON(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to canonicalize JSON value: %w", err)
+		}
+		side[jsonIdentity(value, identityKey, canonical)] = string(canonical)
+	}
+	return side, nil
+}
+
+// canonicalJSON encodes value with sorted object keys and without HTML escaping,
+// so that characters such as '<', '>' and '&' are stored as written.
+func canonicalJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// decodeJSONStream decodes content as a sequence of concatenated JSON values.
+// Numbers are kept as json.Number so that re-encoding does not alter their representation.
+func decodeJSONStream(content string) ([]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var values []interface{}
+	for decoder.More() {
+		if len(values) >= MaxJSONObjects {
+			return values, fmt.Errorf("exceeded maximum number of JSON objects (%d) in note", MaxJSONObjects)
+		}
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return values, fmt.Errorf("invalid JSON at offset %d: %w", decoder.InputOffset(), err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// jsonIdentity returns the deduplication key of a decoded JSON value.
+// Identity keys and canonical forms are prefixed differently so that they never collide.
+func jsonIdentity(value interface{}, identityKey string, canonical []byte) string {
+	if identityKey != "" {
+		current := value
+		found := true
+		for _, part := range strings.Split(identityKey, ".") {
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if current, ok = object[part]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			if id, err := canonicalJSON(current); err == nil && !bytes.Equal(id, []byte("null")) {
+				return "id:" + string(id)
+			}
+		}
+	}
+	return "value:" + string(canonical)
+}
@@ -0,0 +1,105 @@
+package notes
+
+import (
+	"testing"
+)
+
+func TestJSONMergeFunc(t *testing.T) {
+	t.Run("DeduplicatesByCanonicalForm", func(t *testing.T) {
+		merge := JSONMergeFunc("")
+		local := `{"id":"a","status":"pass"}{"id":"b","status":"fail"}`
+		remote := "{\"status\": \"pass\", \"id\": \"a\"}\n{\"id\":\"c\",\"n\":1.50}"
+
+		merged, err := merge("abcd", local, remote, "")
+		if err != nil {
+			t.Fatalf("JSONMergeFunc failed: %v", err)
+		}
+		expected := `{"id":"a","status":"pass"}` + "\n" + `{"id":"b","status":"fail"}` + "\n" + `{"id":"c","n":1.50}`
+		if merged != expected {
+			t.Errorf("Unexpected merge result.\nExpected: %s\nGot:      %s", expected, merged)
+		}
+
+		// Swapping the sides must produce the same stream.
+		swapped, err := merge("abcd", remote, local, "")
+		if err != nil {
+			t.Fatalf("JSONMergeFunc (swapped) failed: %v", err)
+		}
+		if swapped != merged {
+			t.Errorf("Merge result depends on side order.\nFirst:  %s\nSecond: %s", merged, swapped)
+		}
+	})
+
+	t.Run("DeduplicatesByIdentityKeyPreferringLocal", func(t *testing.T) {
+		merge := JSONMergeFunc("test.name")
+		local := `{"test":{"name":"t1"},"status":"fail"}`
+		remote := `{"test":{"name":"t1"},"status":"pass"}{"test":{"name":"t2"},"status":"pass"}[1,2]`
+
+		merged, err := merge("abcd", local, remote, "")
+		if err != nil {
+			t.Fatalf("JSONMergeFunc failed: %v", err)
+		}
+		expected := `{"status":"fail","test":{"name":"t1"}}` + "\n" +
+			`{"status":"pass","test":{"name":"t2"}}` + "\n" +
+			`[1,2]`
+		if merged != expected {
+			t.Errorf("Unexpected merge result.\nExpected: %s\nGot:      %s", expected, merged)
+		}
+	})
+
+	t.Run("ThreeWayMergeKeepsRemovals", func(t *testing.T) {
+		merge := JSONMergeFunc("id")
+		base := `{"id":"a","status":"pass"}{"id":"b","status":"pass"}{"id":"c","status":"pass"}`
+		// Local removes "a" and changes "c"; remote removes "c" and changes "b".
+		local := `{"id":"b","status":"pass"}{"id":"c","status":"fail"}`
+		remote := `{"id":"a","status":"pass"}{"id":"b","status":"fail"}{"id":"d","status":"pass"}`
+
+		merged, err := merge("abcd", local, remote, base)
+		if err != nil {
+			t.Fatalf("JSONMergeFunc failed: %v", err)
+		}
+		expected := `{"id":"b","status":"fail"}` + "\n" +
+			`{"id":"c","status":"fail"}` + "\n" +
+			`{"id":"d","status":"pass"}`
+		if merged != expected {
+			t.Errorf("Unexpected merge result.\nExpected: %s\nGot:      %s", expected, merged)
+		}
+	})
+
+	t.Run("DoesNotEscapeHTML", func(t *testing.T) {
+		merged, err := JSONMergeFunc("")("abcd", `{"msg":"a < b && c > d"}`, `{"msg":"ok"}`, "")
+		if err != nil {
+			t.Fatalf("JSONMergeFunc failed: %v", err)
+		}
+		expected := `{"msg":"a < b && c > d"}` + "\n" + `{"msg":"ok"}`
+		if merged != expected {
+			t.Errorf("Unexpected merge result.\nExpected: %s\nGot:      %s", expected, merged)
+		}
+	})
+
+	t.Run("InvalidJSONFails", func(t *testing.T) {
+		if _, err := JSONMergeFunc("")("abcd", `{"id":1}`, `not json`, ""); err == nil {
+			t.Error("Expected an error for invalid remote JSON, got nil")
+		}
+	})
+}
+
+func TestPushNotesWithJSONMerge(t *testing.T) {
+	_, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	manager := NewNotesManager("json-merge", WithMergeFunc(JSONMergeFunc("id")))
+
+	pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, `{"id":"remote","count":1}`)
+	if err := SetNoteJSON(manager, commitSha, MyCustomData{ID: "local", Count: 2}); err != nil {
+		t.Fatalf("SetNoteJSON failed: %v", err)
+	}
+	if err := manager.PushNotes("testorigin"); err != nil {
+		t.Fatalf("PushNotes failed: %v", err)
+	}
+
+	values, err := GetNoteJSON[MyCustomData](manager, commitSha)
+	if err != nil {
+		t.Fatalf("GetNoteJSON failed: %v", err)
+	}
+	if len(values) != 2 || values[0].ID != "local" || values[1].ID != "remote" {
+		t.Errorf("Expected merged local and remote objects, got %+v", values)
+	}
+}
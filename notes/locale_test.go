@@ -0,0 +1,87 @@
+package notes
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestOperationsUnderLocales(t *testing.T) {
+	locales := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"German", map[string]string{"LANGUAGE": "de", "LC_ALL": "C.UTF-8"}},
+		{"French", map[string]string{"LANGUAGE": "fr", "LANG": "fr_FR.UTF-8", "LC_ALL": "C.UTF-8"}},
+		{"Spanish", map[string]string{"LANGUAGE": "es", "LC_MESSAGES": "C.UTF-8", "LC_ALL": ""}},
+	}
+
+	for _, locale := range locales {
+		t.Run(locale.name, func(t *testing.T) {
+			for key, value := range locale.env {
+				t.Setenv(key, value)
+			}
+			localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+			if out, _ := exec.Command("git", "-C", localPath, "notes", "show", commitSha).CombinedOutput(); strings.Contains(string(out), "no note found") {
+				t.Logf("git messages are not translated in this environment: %s", out)
+			}
+
+			manager := NewNotesManager("locale")
+			if _, err := manager.GetNote(commitSha); !IsNoteNotFound(err) {
+				t.Errorf("Expected NoteNotFoundError, got %v", err)
+			}
+			if _, err := manager.GetNote("deadbeef"); !IsInvalidCommitSha(err) {
+				t.Errorf("Expected InvalidCommitShaError, got %v", err)
+			}
+			if err := manager.DeleteNote(commitSha); err != nil {
+				t.Errorf("Expected deleting a missing note to succeed, got %v", err)
+			}
+			if _, err := manager.GetNoteList(); !IsNotesRefNotFound(err) {
+				t.Errorf("Expected NotesRefNotFoundError, got %v", err)
+			}
+			if result, err := manager.FetchNotesWithResult("testorigin"); err != nil || result.NewRemoteTip != "" {
+				t.Errorf("Expected fetching missing remote notes to succeed, got %+v (%v)", result, err)
+			}
+
+			// A concurrent remote change is merged and pushed.
+			if err := manager.SetNote(commitSha, "local"); err != nil {
+				t.Fatalf("SetNote failed: %v", err)
+			}
+			pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+			if err := manager.PushNotes("testorigin"); err != nil {
+				t.Fatalf("PushNotes failed: %v", err)
+			}
+			if note, _ := manager.GetNote(commitSha); !strings.Contains(note, "local") || !strings.Contains(note, "remote") {
+				t.Errorf("Expected both notes to be merged, got %q", note)
+			}
+
+			// Merging remote notes already in the local ref is not an error.
+			if _, err := manager.FetchNotesMerge("testorigin"); err != nil {
+				t.Errorf("Expected an up-to-date merge to succeed, got %v", err)
+			}
+
+			// Manual merges report conflicts.
+			runCmd(t, clonePath, "git", "fetch", "origin", "+"+manager.GetRef()+":"+manager.GetRef())
+			pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote again")
+			if err := manager.SetNote(commitSha, "local again"); err != nil {
+				t.Fatalf("SetNote failed: %v", err)
+			}
+			manual := NewNotesManager("locale", WithMergeStrategy(MergeManual))
+			if _, err := manual.FetchNotesMerge("testorigin"); err == nil || !strings.Contains(err.Error(), "conflict") {
+				t.Errorf("Expected a merge conflict, got %v", err)
+			}
+		})
+	}
+
+	t.Run("RejectedPushIsRetryable", func(t *testing.T) {
+		err := &GitCommandError{
+			Args:     []string{"push", "--porcelain", "origin", "refs/notes/commits"},
+			ExitCode: 1,
+			Stdout:   "To origin\n!\trefs/notes/commits:refs/notes/commits\t[rejected] (fetch first)\nDone",
+			Stderr:   "Fehler: Fehler beim Versenden einiger Referenzen",
+		}
+		if !IsRetryableError(err) {
+			t.Error("Expected a push rejected in porcelain output to be retryable")
+		}
+	})
+}
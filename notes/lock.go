@@ -0,0 +1,232 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// lockFileName is the advisory lock file, inside the git common directory, shared by all managers.
+	lockFileName = "notes-manager.lock"
+	// DefaultLockTimeout is how long a manager waits for the repository lock by default.
+	DefaultLockTimeout = 30 * time.Second
+	// DefaultLockStaleAfter is how long an unrefreshed lock of another host is kept by default.
+	DefaultLockStaleAfter = 10 * time.Minute
+)
+
+// LockConfig configures the repository-level advisory lock a manager holds around merges, pushes
+// and notes ref updates, so that managers in other processes working on the same repository do
+// not interleave with them.
+type LockConfig struct {
+	// Disabled turns locking off.
+	Disabled bool
+	// Timeout is how long to wait for the lock before failing with a LockTimeoutError.
+	// Zero means DefaultLockTimeout; a negative value fails immediately if the lock is held.
+	Timeout time.Duration
+	// StaleAfter is how long a lock held by a process on another host may go without being refreshed
+	// before it is removed; holders refresh their lock well within that time. A lock held on this host
+	// is removed exactly when its holder process has exited. Zero means DefaultLockStaleAfter.
+	StaleAfter time.Duration
+	// PollInterval is how often a held lock is checked again. Zero means 50ms.
+	PollInterval time.Duration
+}
+
+// DefaultLockConfig returns the lock configuration used by managers that are not configured otherwise.
+func DefaultLockConfig() LockConfig {
+	return LockConfig{
+		Timeout:      DefaultLockTimeout,
+		StaleAfter:   DefaultLockStaleAfter,
+		PollInterval: 50 * time.Millisecond,
+	}
+}
+
+// WithLock sets the repository lock configuration of the manager.
+func WithLock(config LockConfig) Option {
+	return func(m *notesManager) {
+		m.lockConfig = config
+	}
+}
+
+// LockOwner identifies the holder of the repository lock.
+type LockOwner struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// acquireRepoLock takes the repository lock and returns a function releasing it.
+func acquireRepoLock(ctx context.Context, config LockConfig) (func(), error) {
+	if config.Disabled {
+		return func() {}, nil
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultLockTimeout
+	}
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = DefaultLockStaleAfter
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 50 * time.Millisecond
+	}
+
+	path, err := lockPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	owner := LockOwner{PID: os.Getpid(), Hostname: hostname}
+
+	start := time.Now()
+	for {
+		owner.Acquired = time.Now()
+		created, err := createLockFile(path, owner)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return holdLock(path, config.StaleAfter), nil
+		}
+
+		holder, data, stale := inspectLock(path, hostname, config.StaleAfter)
+		if stale {
+			removeStaleLock(path, data)
+			continue
+		}
+		if time.Since(start)+config.PollInterval > config.Timeout {
+			return nil, &LockTimeoutError{Path: path, Owner: holder, Waited: time.Since(start)}
+		}
+		time.Sleep(config.PollInterval)
+	}
+}
+
+// holdLock refreshes the modification time of the lock file while it is held, so that processes on
+// other hosts do not take it for abandoned, and returns the function releasing it.
+func holdLock(path string, staleAfter time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(staleAfter / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				_ = os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		_ = os.Remove(path)
+	}
+}
+
+// lockPath returns the location of the lock file of the current repository.
+func lockPath(ctx context.Context) (string, error) {
+	commonDir, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory (stderr: %s): %w", stderr, err)
+	}
+	return filepath.Join(commonDir, lockFileName), nil
+}
+
+// createLockFile creates the lock file exclusively. It reports false if the file already exists.
+func createLockFile(path string, owner LockOwner) (bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create lock file %s: %w", path, err)
+	}
+	data, _ := json.Marshal(owner)
+	_, writeErr := f.Write(data)
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		_ = os.Remove(path)
+		return false, fmt.Errorf("failed to write lock file %s: %w", path, writeErr)
+	}
+	return true, nil
+}
+
+// inspectLock reads the lock file and reports its holder, its raw content and whether it is stale.
+// A lock held on this host is stale once its holder process has exited; any other lock is stale
+// once it has not been refreshed for staleAfter. A lock file that disappeared in the meantime is
+// reported as stale.
+func inspectLock(path, hostname string, staleAfter time.Duration) (LockOwner, []byte, bool) {
+	var holder LockOwner
+	info, err := os.Stat(path)
+	if err != nil {
+		return holder, nil, true
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return holder, nil, true
+	}
+	if json.Unmarshal(data, &holder) != nil || holder.Acquired.IsZero() {
+		// The holder may still be writing it; fall back to the file's age.
+		holder.Acquired = info.ModTime()
+	}
+
+	if holder.PID > 0 && holder.Hostname != "" && holder.Hostname == hostname {
+		return holder, data, !processAlive(holder.PID)
+	}
+	return holder, data, time.Since(info.ModTime()) > staleAfter
+}
+
+// removeStaleLock removes the lock file if it still has the content that was found to be stale.
+func removeStaleLock(path string, data []byte) {
+	if data == nil {
+		return
+	}
+	current, err := os.ReadFile(path)
+	if err == nil && string(current) == string(data) {
+		_ = os.Remove(path)
+	}
+}
+
+// processAlive reports whether a process with the given PID exists on this host.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || !(errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH))
+}
+
+// withRepoLock runs fn while holding the manager's repository lock.
+func (m *notesManager) withRepoLock(fn func() error) error {
+	release, err := acquireRepoLock(m.gitContext(), m.lockConfig)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+// notesMergeInProgress reports whether an unfinished `git notes merge` left its state behind.
+func notesMergeInProgress(ctx context.Context) (bool, error) {
+	for _, name := range []string{"NOTES_MERGE_PARTIAL", "NOTES_MERGE_REF"} {
+		path, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--git-path", name)
+		if err != nil {
+			return false, fmt.Errorf("failed to locate %s (stderr: %s): %w", name, stderr, err)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,171 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepoLock(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	lockFile := filepath.Join(localPath, ".git", lockFileName)
+	hostname, _ := os.Hostname()
+
+	writeLock := func(t *testing.T, owner LockOwner) {
+		t.Helper()
+		data, _ := json.Marshal(owner)
+		if err := os.WriteFile(lockFile, data, 0644); err != nil {
+			t.Fatalf("Failed to write lock file: %v", err)
+		}
+		_ = os.Chtimes(lockFile, owner.Acquired, owner.Acquired)
+	}
+	quick := LockConfig{Timeout: 100 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+
+	t.Run("TimesOutWhileHeld", func(t *testing.T) {
+		writeLock(t, LockOwner{PID: os.Getpid(), Hostname: hostname, Acquired: time.Now()})
+		defer os.Remove(lockFile)
+
+		manager := NewNotesManager("locked", WithLock(quick))
+		err := manager.SetNote(commitSha, "blocked")
+		if !IsLockTimeout(err) {
+			t.Fatalf("Expected LockTimeoutError, got %v", err)
+		}
+		if lockErr := err.(*LockTimeoutError); lockErr.Owner.PID != os.Getpid() {
+			t.Errorf("Expected the holder to be reported, got %+v", lockErr.Owner)
+		}
+
+		disabled := NewNotesManager("locked", WithLock(LockConfig{Disabled: true}))
+		if err := disabled.SetNote(commitSha, "unlocked"); err != nil {
+			t.Errorf("Expected a manager without locking to ignore the lock, got %v", err)
+		}
+	})
+
+	t.Run("KeepsOldLockOfLiveHolder", func(t *testing.T) {
+		writeLock(t, LockOwner{PID: os.Getpid(), Hostname: hostname, Acquired: time.Now().Add(-time.Hour)})
+		defer os.Remove(lockFile)
+
+		manager := NewNotesManager("locked", WithLock(LockConfig{Timeout: 100 * time.Millisecond, StaleAfter: time.Minute}))
+		if err := manager.SetNote(commitSha, "blocked"); !IsLockTimeout(err) {
+			t.Fatalf("Expected the lock of a live holder to be kept, got %v", err)
+		}
+	})
+
+	t.Run("RefreshedWhileHeld", func(t *testing.T) {
+		staleAfter := 60 * time.Millisecond
+		release, err := acquireRepoLock(context.Background(), LockConfig{StaleAfter: staleAfter})
+		if err != nil {
+			t.Fatalf("acquireRepoLock failed: %v", err)
+		}
+		old := time.Now().Add(-time.Hour)
+		_ = os.Chtimes(lockFile, old, old)
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, _, stale := inspectLock(lockFile, "elsewhere", staleAfter); !stale {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected the held lock to be refreshed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		release()
+		if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+			t.Error("Expected the lock to be released")
+		}
+	})
+
+	t.Run("RemovesStaleLocks", func(t *testing.T) {
+		exited := exec.Command("true")
+		if err := exited.Run(); err != nil {
+			t.Fatalf("Failed to run helper process: %v", err)
+		}
+		for name, owner := range map[string]LockOwner{
+			"ExitedHolder": {PID: exited.Process.Pid, Hostname: hostname, Acquired: time.Now()},
+			"Expired":      {PID: os.Getpid(), Hostname: "elsewhere", Acquired: time.Now().Add(-time.Hour)},
+		} {
+			writeLock(t, owner)
+			manager := NewNotesManager("locked", WithLock(LockConfig{Timeout: 100 * time.Millisecond, StaleAfter: time.Minute}))
+			if err := manager.SetNote(commitSha, name); err != nil {
+				t.Errorf("%s: expected the stale lock to be taken over, got %v", name, err)
+			}
+			if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+				t.Errorf("%s: expected the lock to be released", name)
+			}
+		}
+	})
+
+	t.Run("SerializesConcurrentWriters", func(t *testing.T) {
+		var shas []string
+		for i := 0; i < 5; i++ {
+			shas = append(shas, createTestCommit(t, localPath, fmt.Sprintf("lock%d.txt", i), "x", "Lock commit"))
+		}
+		var wg sync.WaitGroup
+		errs := make([]error, len(shas))
+		for i, sha := range shas {
+			wg.Add(1)
+			go func(i int, sha string) {
+				defer wg.Done()
+				errs[i] = NewNotesManager("concurrent").SetNote(sha, "note")
+			}(i, sha)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("SetNote %d failed: %v", i, err)
+			}
+		}
+		if list, _ := NewNotesManager("concurrent").GetNoteList(); len(list) != len(shas) {
+			t.Errorf("Expected %d notes, got %v", len(shas), list)
+		}
+	})
+
+	t.Run("KeepsUnfinishedMerge", func(t *testing.T) {
+		manager := NewNotesManager("locked")
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+
+		mergeRef := filepath.Join(localPath, ".git", "NOTES_MERGE_REF")
+		if err := os.WriteFile(mergeRef, []byte("ref: refs/notes/someone-else\n"), 0644); err != nil {
+			t.Fatalf("Failed to simulate an unfinished merge: %v", err)
+		}
+		defer os.Remove(mergeRef)
+
+		if err := manager.FetchNotes("testorigin"); !IsMergeInProgress(err) {
+			t.Fatalf("Expected MergeInProgressError, got %v", err)
+		}
+		if _, err := os.Stat(mergeRef); err != nil {
+			t.Errorf("Expected the unfinished merge to be left alone: %v", err)
+		}
+		if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+			t.Error("Expected the lock to be released after a failed merge")
+		}
+	})
+
+	t.Run("ReleasedBetweenFetchAttempts", func(t *testing.T) {
+		for name, mode := range map[string]FetchMode{"Merge": FetchMerge, "Force": FetchForce} {
+			var held []bool
+			policy := RetryPolicy{
+				MaxAttempts: 3,
+				Retryable:   func(error) bool { return true },
+				OnAttempt: func(RetryAttempt) {
+					_, err := os.Stat(lockFile)
+					held = append(held, err == nil)
+				},
+			}
+			manager := NewNotesManager("locked", WithRetryPolicy(policy), WithFetchMode(mode))
+			remote := Remote{URL: filepath.Join(localPath, "missing.git")}
+			if _, err := manager.FetchNotesFrom(remote); err == nil {
+				t.Fatalf("%s: expected the fetch from a missing repository to fail", name)
+			}
+			if len(held) != 3 || held[0] || held[1] || held[2] {
+				t.Errorf("%s: expected the lock to be released after every attempt, got %v", name, held)
+			}
+		}
+	})
+}
@@ -0,0 +1,400 @@
+package notes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MergeStrategy is one of git's built-in notes merge strategies (see `git notes merge -s`).
+type MergeStrategy string
+
+const (
+	// MergeCatSortUniq concatenates conflicting notes, then sorts them and removes duplicate lines.
+	MergeCatSortUniq MergeStrategy = "cat_sort_uniq"
+	// MergeUnion concatenates conflicting notes.
+	MergeUnion MergeStrategy = "union"
+	// MergeOurs keeps the local version of conflicting notes.
+	MergeOurs MergeStrategy = "ours"
+	// MergeTheirs keeps the remote version of conflicting notes.
+	MergeTheirs MergeStrategy = "theirs"
+	// MergeManual leaves conflicts to be resolved by the manager's MergeFunc.
+	MergeManual MergeStrategy = "manual"
+)
+
+// WithMergeStrategy sets the strategy used to merge remote notes into the local notes ref.
+// The default is MergeCatSortUniq. A MergeFunc, if configured, takes precedence.
+func WithMergeStrategy(strategy MergeStrategy) Option {
+	return func(m *notesManager) {
+		m.mergeStrategy = strategy
+	}
+}
+
+// MergeFunc resolves a single conflicting note while merging remote notes into the local notes ref.
+// sha is the annotated object, and local, remote and base hold the note content on each side of the
+// merge ("" when the note does not exist on that side). The returned content replaces the note;
+// returning an empty string removes it. Returning an error aborts the whole merge.
+type MergeFunc func(sha string, local, remote, base string) (string, error)
+
+// WithMergeFunc makes the manager resolve conflicting notes with fn instead of git's
+// built-in merge strategies when merging remote notes.
+func WithMergeFunc(fn MergeFunc) Option {
+	return func(m *notesManager) {
+		m.mergeFunc = fn
+	}
+}
+
+// MergeResult describes how merging remote notes changed the local notes ref.
+// Added, Changed and Removed list the annotated object SHAs whose notes were affected.
+type MergeResult struct {
+	Strategy MergeStrategy
+	OldTip   string
+	NewTip   string
+	Added    []string
+	Changed  []string
+	Removed  []string
+	// Conflicts lists the annotated object SHAs whose notes changed on both sides and were
+	// resolved by the merge strategy or the MergeFunc.
+	Conflicts []string
+}
+
+// UpToDate reports whether the merge left the local notes ref unchanged.
+func (r *MergeResult) UpToDate() bool {
+	return r.OldTip == r.NewTip
+}
+
+// effectiveMergeStrategy returns the git strategy actually used for merges.
+func (m *notesManager) effectiveMergeStrategy() MergeStrategy {
+	if m.mergeFunc != nil {
+		return MergeManual
+	}
+	if m.mergeStrategy == "" {
+		return MergeCatSortUniq
+	}
+	return m.mergeStrategy
+}
+
+// mergeRemoteNotes merges the notes at remoteRef into the local notes ref and reports the changes.
+// If the merge fails, any partial merge is aborted and the local ref is restored.
+func (m *notesManager) mergeRemoteNotes(remoteRef string) (*MergeResult, error) {
+	// An unfinished merge may belong to another process or to a user resolving conflicts by hand,
+	// so it is reported instead of being aborted. Callers hold the repository lock, which keeps
+	// other managers from starting a merge concurrently.
+	inProgress, err := notesMergeInProgress(m.gitContext())
+	if err != nil {
+		return nil, err
+	}
+	if inProgress {
+		return nil, &MergeInProgressError{Ref: m.ref}
+	}
+
+	// Save the current local ref before merge attempt (for potential rollback).
+	// If local ref doesn't exist yet, that's okay.
+	localRefSHA := refTip(m.gitContext(), m.ref)
+
+	strategy := m.effectiveMergeStrategy()
+	var conflicts []string
+	if m.mergeFunc != nil {
+		conflicts, err = m.mergeWithFunc(remoteRef, localRefSHA)
+	} else {
+		conflicts, err = m.mergeWithStrategy(remoteRef, localRefSHA, strategy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := newMergeResult(m.gitContext(), strategy, localRefSHA, refTip(m.gitContext(), m.ref))
+	if err != nil {
+		return nil, err
+	}
+	result.Conflicts = conflicts
+	return result, nil
+}
+
+// newMergeResult builds a MergeResult listing the notes that differ between oldTip and newTip.
+func newMergeResult(ctx context.Context, strategy MergeStrategy, oldTip, newTip string) (*MergeResult, error) {
+	result := &MergeResult{Strategy: strategy, OldTip: oldTip, NewTip: newTip}
+	if result.UpToDate() {
+		return result, nil
+	}
+
+	before, err := listNoteBlobs(ctx, oldTip)
+	if err != nil {
+		return nil, err
+	}
+	after, err := listNoteBlobs(ctx, newTip)
+	if err != nil {
+		return nil, err
+	}
+	result.Added, result.Changed, result.Removed = diffNoteBlobs(before, after)
+	return result, nil
+}
+
+// mergeWithStrategy merges remoteRef using one of git's built-in strategies and returns the
+// annotated objects whose conflicting notes the strategy resolved.
+func (m *notesManager) mergeWithStrategy(remoteRef, localRefSHA string, strategy MergeStrategy) ([]string, error) {
+	// Without local notes every remote note is taken as is.
+	var sides *mergeSides
+	if localRefSHA != "" {
+		var err error
+		if sides, err = m.loadMergeSides(localRefSHA, remoteRef); err != nil {
+			return nil, err
+		}
+	}
+
+	_, mergeStderr, mergeErr := m.git("notes", "--ref", m.ref, "merge", "-s", string(strategy), remoteRef)
+	if mergeErr != nil {
+		// Remote notes already contained in the local ref are not an error in this context.
+		if localRefSHA != "" && isAncestor(m.gitContext(), remoteRef, localRefSHA) {
+			return nil, nil
+		}
+
+		// A merge that stopped on conflicts leaves a notes merge in progress.
+		conflict, _ := notesMergeInProgress(m.gitContext())
+		var conflicts []string
+		if conflict {
+			_, conflicts, _ = notesMergeWorktree(m.gitContext())
+		}
+		m.rollbackMerge(localRefSHA)
+
+		if conflict {
+			return nil, &MergeConflictError{Ref: m.ref, RemoteRef: remoteRef, Strategy: strategy, Conflicts: conflicts, Err: mergeErr}
+		}
+		return nil, fmt.Errorf("failed to merge notes from '%s' into '%s': %w; stderr: %s",
+			remoteRef, m.ref, mergeErr, mergeStderr)
+	}
+	return conflictingNotes(sides), nil
+}
+
+// conflictingNotes returns the sorted annotated objects whose notes changed differently on the
+// local and the remote side of a merge, i.e. those a merge strategy has to resolve. A note removed
+// on one side and changed on the other conflicts as well. A nil sides has no conflicts.
+func conflictingNotes(sides *mergeSides) []string {
+	if sides == nil {
+		return nil
+	}
+	var conflicts []string
+	for sha, local := range sides.local {
+		remote, base := sides.remote[sha], sides.base[sha]
+		if local != base && remote != base && local != remote {
+			conflicts = append(conflicts, sha)
+		}
+	}
+	// Notes removed locally and changed remotely.
+	for sha, remote := range sides.remote {
+		if base, ok := sides.base[sha]; ok && remote != base && sides.local[sha] == "" {
+			conflicts = append(conflicts, sha)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// mergeWithFunc merges remoteRef using git's 'manual' strategy, resolves every conflict left in
+// NOTES_MERGE_WORKTREE by calling the manager's MergeFunc and returns the annotated objects whose
+// notes it resolved.
+func (m *notesManager) mergeWithFunc(remoteRef, localRefSHA string) ([]string, error) {
+	_, mergeStderr, mergeErr := m.git("notes", "--ref", m.ref, "merge", "-s", "manual", remoteRef)
+	if mergeErr == nil || (localRefSHA != "" && isAncestor(m.gitContext(), remoteRef, localRefSHA)) {
+		return nil, nil
+	}
+
+	worktree, _, err := m.git("rev-parse", "--git-path", "NOTES_MERGE_WORKTREE")
+	if err != nil {
+		m.rollbackMerge(localRefSHA)
+		return nil, fmt.Errorf("failed to locate notes merge worktree: %w", err)
+	}
+	entries, err := os.ReadDir(worktree)
+	if err != nil {
+		// No worktree means git failed before producing any conflicts.
+		m.rollbackMerge(localRefSHA)
+		return nil, fmt.Errorf("failed to merge notes from '%s' into '%s': %w; stderr: %s",
+			remoteRef, m.ref, mergeErr, mergeStderr)
+	}
+
+	sides, err := m.loadMergeSides(localRefSHA, remoteRef)
+	if err != nil {
+		m.rollbackMerge(localRefSHA)
+		return nil, err
+	}
+
+	var conflicts []string
+	for _, entry := range entries {
+		sha := entry.Name()
+		if entry.IsDir() || !isObjectName(sha) {
+			continue
+		}
+
+		resolved, err := m.resolveConflict(sha, sides)
+		if err == nil {
+			if resolved == "" {
+				// Notes missing from the worktree are removed by the merge commit.
+				err = os.Remove(filepath.Join(worktree, sha))
+			} else {
+				err = os.WriteFile(filepath.Join(worktree, sha), []byte(resolved), 0644)
+			}
+		}
+		if err != nil {
+			m.rollbackMerge(localRefSHA)
+			return nil, err
+		}
+		conflicts = append(conflicts, sha)
+	}
+
+	if _, stderr, err := m.git("notes", "--ref", m.ref, "merge", "--commit"); err != nil {
+		m.rollbackMerge(localRefSHA)
+		return nil, fmt.Errorf("failed to commit resolved notes merge into '%s': %w; stderr: %s", m.ref, err, stderr)
+	}
+	return conflicts, nil
+}
+
+// resolveConflict reads all three versions of the note for sha and passes them to the MergeFunc.
+func (m *notesManager) resolveConflict(sha string, sides *mergeSides) (string, error) {
+	local, err := readNoteBlob(m.gitContext(), sides.local[sha])
+	if err != nil {
+		return "", err
+	}
+	remote, err := readNoteBlob(m.gitContext(), sides.remote[sha])
+	if err != nil {
+		return "", err
+	}
+	base, err := readNoteBlob(m.gitContext(), sides.base[sha])
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := m.mergeFunc(sha, local, remote, base)
+	if err != nil {
+		return "", fmt.Errorf("merge function failed for %s in %s: %w", sha, m.ref, err)
+	}
+	return resolved, nil
+}
+
+// mergeSides maps annotated object SHAs to note blob SHAs for each side of a notes merge.
+type mergeSides struct {
+	local, remote, base map[string]string
+}
+
+func (m *notesManager) loadMergeSides(localRefSHA, remoteRef string) (*mergeSides, error) {
+	sides := &mergeSides{}
+	var err error
+	if sides.local, err = listNoteBlobs(m.gitContext(), localRefSHA); err != nil {
+		return nil, err
+	}
+	if sides.remote, err = listNoteBlobs(m.gitContext(), remoteRef); err != nil {
+		return nil, err
+	}
+
+	baseSHA := ""
+	if localRefSHA != "" {
+		// Unrelated histories have no merge base; every note then conflicts against an empty base.
+		baseSHA, _, _ = m.git("merge-base", localRefSHA, remoteRef)
+	}
+	if sides.base, err = listNoteBlobs(m.gitContext(), baseSHA); err != nil {
+		return nil, err
+	}
+	return sides, nil
+}
+
+// notesMergeWorktree returns the path of NOTES_MERGE_WORKTREE and the annotated objects whose
+// conflicting notes an unfinished merge left there.
+func notesMergeWorktree(ctx context.Context) (string, []string, error) {
+	worktree, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--git-path", "NOTES_MERGE_WORKTREE")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to locate notes merge worktree (stderr: %s): %w", stderr, err)
+	}
+	entries, _ := os.ReadDir(worktree)
+	var conflicts []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isObjectName(entry.Name()) {
+			conflicts = append(conflicts, entry.Name())
+		}
+	}
+	return worktree, conflicts, nil
+}
+
+// rollbackMerge aborts an in-progress notes merge and resets the notes ref to localRefSHA.
+func (m *notesManager) rollbackMerge(localRefSHA string) {
+	// Abort the failed merge to clean up state
+	_, _, _ = m.git("notes", "--ref", m.ref, "merge", "--abort")
+
+	// If we had a local ref before, reset to it
+	if localRefSHA != "" {
+		_, _, _ = m.git("update-ref", m.ref, strings.TrimSpace(localRefSHA))
+	}
+}
+
+// listNoteBlobs returns the notes stored in the notes tree of commitish, keyed by the annotated
+// object SHA. Fanout directories are flattened. An empty commitish yields an empty map.
+func listNoteBlobs(ctx context.Context, commitish string) (map[string]string, error) {
+	blobs := make(map[string]string)
+	if commitish == "" {
+		return blobs, nil
+	}
+
+	output, stderr, err := executeGitCommandContext(ctx, "ls-tree", "-r", commitish)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes tree of %s (stderr: %s): %w", commitish, stderr, err)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// Output of `git ls-tree -r` is "<mode> <type> <object>\t<path>"
+		meta, path, found := strings.Cut(scanner.Text(), "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) < 3 || fields[1] != "blob" {
+			continue
+		}
+		sha := strings.ReplaceAll(path, "/", "")
+		if isObjectName(sha) {
+			blobs[sha] = fields[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning notes tree of %s: %w", commitish, err)
+	}
+	return blobs, nil
+}
+
+// isObjectName reports whether name is a full object name, in either SHA-1 or SHA-256 repositories.
+func isObjectName(name string) bool {
+	return (len(name) == 40 || len(name) == 64) && hexCharPattern.MatchString(name)
+}
+
+// diffNoteBlobs compares two notes trees as returned by listNoteBlobs and returns the sorted
+// annotated object SHAs whose notes were added, changed or removed going from before to after.
+func diffNoteBlobs(before, after map[string]string) (added, changed, removed []string) {
+	for sha, blob := range after {
+		oldBlob, ok := before[sha]
+		if !ok {
+			added = append(added, sha)
+		} else if oldBlob != blob {
+			changed = append(changed, sha)
+		}
+	}
+	for sha := range before {
+		if _, ok := after[sha]; !ok {
+			removed = append(removed, sha)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
+
+// readNoteBlob returns the content of a note blob, or "" if blob is empty.
+func readNoteBlob(ctx context.Context, blob string) (string, error) {
+	if blob == "" {
+		return "", nil
+	}
+	content, stderr, err := executeGitCommandContext(ctx, "cat-file", "blob", blob)
+	if err != nil {
+		return "", fmt.Errorf("failed to read note blob %s (stderr: %s): %w", blob, stderr, err)
+	}
+	return content, nil
+}
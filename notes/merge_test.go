@@ -0,0 +1,129 @@
+package notes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPushNotesWithMergeFunc(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+
+	t.Run("ResolvesConflictsWithCallback", func(t *testing.T) {
+		var calls int
+		manager := NewNotesManager("merge-func", WithMergeFunc(func(sha, local, remote, base string) (string, error) {
+			calls++
+			if sha != commitSha {
+				t.Errorf("MergeFunc called for unexpected sha %s", sha)
+			}
+			if base != "base" {
+				t.Errorf("MergeFunc base: expected 'base', got %q", base)
+			}
+			return "resolved:" + local + "+" + remote, nil
+		}))
+
+		if err := manager.SetNote(commitSha, "base"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		if err := manager.PushNotes("testorigin"); err != nil {
+			t.Fatalf("Initial PushNotes failed: %v", err)
+		}
+		runCmd(t, clonePath, "git", "fetch", "origin", manager.GetRef()+":"+manager.GetRef())
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+
+		if err := manager.SetNote(commitSha, "local"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		result, err := manager.PushNotesWithResult("testorigin", 3)
+		if err != nil {
+			t.Fatalf("PushNotes with MergeFunc failed: %v", err)
+		}
+
+		if calls != 1 {
+			t.Errorf("Expected MergeFunc to be called once, got %d", calls)
+		}
+		note, err := manager.GetNote(commitSha)
+		if err != nil {
+			t.Fatalf("GetNote failed: %v", err)
+		}
+		if note != "resolved:local+remote" {
+			t.Errorf("Expected resolved note, got %q", note)
+		}
+		if !reflect.DeepEqual(result.Merge.Conflicts, []string{commitSha}) {
+			t.Errorf("Expected the resolved conflict in the merge result, got %v", result.Merge.Conflicts)
+		}
+	})
+
+	t.Run("EmptyResolutionRemovesNote", func(t *testing.T) {
+		manager := NewNotesManager("merge-func-remove", WithMergeFunc(func(sha, local, remote, base string) (string, error) {
+			return "", nil
+		}))
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+		if err := manager.SetNote(commitSha, "local"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		if err := manager.PushNotes("testorigin"); err != nil {
+			t.Fatalf("PushNotes failed: %v", err)
+		}
+		if _, err := manager.GetNote(commitSha); !IsNoteNotFound(err) {
+			t.Errorf("Expected note to be removed, got err=%v", err)
+		}
+		// The note is removed by the merge commit itself.
+		if parents, _ := runCmd(t, localPath, "git", "rev-list", "--parents", "-n", "1", manager.GetRef()); len(strings.Fields(parents)) != 3 {
+			t.Errorf("Expected the notes tip to be the merge commit, got %q", parents)
+		}
+	})
+
+	t.Run("CallbackErrorRestoresLocalRef", func(t *testing.T) {
+		errResolve := errors.New("cannot resolve")
+		manager := NewNotesManager("merge-func-error", WithMergeFunc(func(sha, local, remote, base string) (string, error) {
+			return "", errResolve
+		}))
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+		if err := manager.SetNote(commitSha, "local"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		before, _ := runCmd(t, localPath, "git", "rev-parse", manager.GetRef())
+
+		err := manager.PushNotes("testorigin")
+		if !errors.Is(err, errResolve) {
+			t.Fatalf("Expected PushNotes to fail with the callback error, got: %v", err)
+		}
+
+		after, _ := runCmd(t, localPath, "git", "rev-parse", manager.GetRef())
+		if before != after {
+			t.Errorf("Local notes ref moved after failed merge: before %s, after %s", before, after)
+		}
+		if _, err := os.Stat(filepath.Join(localPath, ".git", "NOTES_MERGE_PARTIAL")); !os.IsNotExist(err) {
+			t.Errorf("Expected notes merge state to be cleaned up, stat err: %v", err)
+		}
+		note, _ := manager.GetNote(commitSha)
+		if strings.TrimSpace(note) != "local" {
+			t.Errorf("Expected local note to be kept, got %q", note)
+		}
+	})
+}
+
+func TestConflictingNotes(t *testing.T) {
+	// Notes of SHA-256 repositories are named by 64 hex characters.
+	a, b, c, d, e := strings.Repeat("a", 64), strings.Repeat("b", 40), strings.Repeat("c", 40), strings.Repeat("d", 40), strings.Repeat("e", 40)
+	sides := &mergeSides{
+		local:  map[string]string{a: "local-a", b: "local-b", c: "base-c", e: "same-e"},
+		remote: map[string]string{a: "remote-a", c: "remote-c", d: "remote-d", e: "same-e"},
+		base:   map[string]string{a: "base-a", b: "base-b", c: "base-c", d: "base-d"},
+	}
+	// a changed on both sides, b changed locally and removed remotely, d removed locally and
+	// changed remotely; c only changed remotely and e was added identically on both sides.
+	if got := conflictingNotes(sides); !reflect.DeepEqual(got, []string{a, b, d}) {
+		t.Errorf("conflictingNotes() = %v", got)
+	}
+	if got := conflictingNotes(nil); got != nil {
+		t.Errorf("conflictingNotes(nil) = %v", got)
+	}
+	if !isObjectName(a) || !isObjectName(b) || isObjectName(strings.Repeat("a", 41)) || isObjectName(strings.Repeat("g", 40)) {
+		t.Error("isObjectName() must accept exactly the full SHA-1 and SHA-256 object names")
+	}
+}
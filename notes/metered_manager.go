@@ -0,0 +1,71 @@
+package notes
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// NewMeteredNotesManager wraps manager so that its calls are recorded in metrics. GetRef is not
+// recorded.
+//
+// Push retries are recorded for every call pushing notes, including PushNotes and FlushPending.
+// Git commands are counted like OperationEvent.GitCommands. Merge conflicts resolved by the merge strategy or MergeFunc are
+// taken from the MergeResult of the calls returning one, so FetchNotes and PushNotes only count the
+// conflicts that made them fail.
+func NewMeteredNotesManager(manager NotesManager, metrics *Metrics) NotesManager {
+	return &instrumentedNotesManager{NotesManager: manager, instrument: meterCalls(manager, metrics)}
+}
+
+// meterCalls returns the instrumenter recording the calls of manager in metrics, along with the
+// size of the notes they read or write, the push retries and the merge conflicts they report.
+// The calls run with a context counting their git commands and push retries.
+func meterCalls(manager NotesManager, metrics *Metrics) callInstrumenter {
+	return func(ctx context.Context, call managerCall) (context.Context, func(any, error)) {
+		start := time.Now()
+		var commands atomic.Int64
+		ctx = withGitCommandListener(ctx, nil, func(*GitCommand) func() {
+			commands.Add(1)
+			return nil
+		})
+		var retries atomic.Int64
+		ctx = withPushAttemptsListener(ctx, func(attempts int) {
+			retries.Add(int64(attempts - 1))
+		})
+
+		return ctx, func(result any, err error) {
+			namespace := manager.GetRef()
+			metrics.recordOperation(namespace, call.operation, time.Since(start), int(commands.Load()), err)
+			if n := retries.Load(); n > 0 {
+				metrics.recordPushRetries(namespace, int(n))
+			}
+			switch result := result.(type) {
+			case string:
+				if err == nil {
+					metrics.recordNoteSize(namespace, call.operation, len(result))
+				}
+			case map[string]string:
+				for _, note := range result {
+					metrics.recordNoteSize(namespace, call.operation, len(note))
+				}
+			case *MergeResult:
+				recordMerge(metrics, namespace, result)
+			case *FetchResult:
+				if result != nil {
+					recordMerge(metrics, namespace, result.Merge)
+				}
+			case *PushResult:
+				if result != nil {
+					recordMerge(metrics, namespace, result.Merge)
+				}
+			}
+		}
+	}
+}
+
+// recordMerge records the conflicts resolved by a merge, if any.
+func recordMerge(metrics *Metrics, namespace string, merge *MergeResult) {
+	if merge != nil && len(merge.Conflicts) > 0 {
+		metrics.recordMergeConflicts(namespace, len(merge.Conflicts))
+	}
+}
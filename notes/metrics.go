@@ -0,0 +1,221 @@
+package notes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the operation duration histogram.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// DefaultNoteSizeBuckets are the upper bounds, in bytes, of the note size histogram.
+var DefaultNoteSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Metrics collects the metrics of the managers created by NewMeteredNotesManager and exposes them
+// in the Prometheus text format. A Metrics can be shared by several managers; their metrics are
+// labeled by namespace.
+type Metrics struct {
+	mu sync.Mutex
+	// The maps are keyed by label values joined with "\x00".
+	operations     map[string]float64
+	errors         map[string]float64
+	durations      map[string]*histogram
+	gitCommands    map[string]float64
+	pushRetries    map[string]float64
+	mergeConflicts map[string]float64
+	noteSizes      map[string]*histogram
+	cacheLookups   map[string]float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		operations:     make(map[string]float64),
+		errors:         make(map[string]float64),
+		durations:      make(map[string]*histogram),
+		gitCommands:    make(map[string]float64),
+		pushRetries:    make(map[string]float64),
+		mergeConflicts: make(map[string]float64),
+		noteSizes:      make(map[string]*histogram),
+		cacheLookups:   make(map[string]float64),
+	}
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(value float64) {
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+func labelKey(values ...string) string {
+	return strings.Join(values, "\x00")
+}
+
+func (m *Metrics) observe(histograms map[string]*histogram, bounds []float64, key string, value float64) {
+	h, ok := histograms[key]
+	if !ok {
+		h = newHistogram(bounds)
+		histograms[key] = h
+	}
+	h.observe(value)
+}
+
+// recordOperation records a finished call of a manager.
+func (m *Metrics) recordOperation(namespace, operation string, duration time.Duration, gitCommands int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := labelKey(namespace, operation)
+	m.operations[key]++
+	m.observe(m.durations, DefaultDurationBuckets, key, duration.Seconds())
+	m.gitCommands[key] += float64(gitCommands)
+	if err != nil {
+		m.errors[labelKey(namespace, operation, string(categorize(err)))]++
+		var conflictErr *MergeConflictError
+		if errors.As(err, &conflictErr) {
+			m.mergeConflicts[namespace] += float64(max(len(conflictErr.Conflicts), 1))
+		}
+	}
+}
+
+func (m *Metrics) recordMergeConflicts(namespace string, conflicts int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mergeConflicts[namespace] += float64(conflicts)
+}
+
+func (m *Metrics) recordPushRetries(namespace string, retries int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pushRetries[namespace] += float64(retries)
+}
+
+func (m *Metrics) recordNoteSize(namespace, operation string, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observe(m.noteSizes, DefaultNoteSizeBuckets, labelKey(namespace, operation), float64(size))
+}
+
+// RecordCacheLookup records a lookup in a cache of notes kept by the application for namespace.
+// The package does not cache notes itself.
+func (m *Metrics) RecordCacheLookup(namespace string, hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups[labelKey(namespace, result)]++
+}
+
+// Handler returns an http.Handler serving the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteText(w)
+	})
+}
+
+// WriteText writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := bufio.NewWriter(w)
+	writeCounter(b, "notes_operations_total", "Number of finished manager calls.",
+		[]string{"namespace", "operation"}, m.operations)
+	writeCounter(b, "notes_operation_errors_total", "Number of failed manager calls by error category.",
+		[]string{"namespace", "operation", "category"}, m.errors)
+	writeHistogram(b, "notes_operation_duration_seconds", "Duration of manager calls.",
+		[]string{"namespace", "operation"}, m.durations)
+	writeCounter(b, "notes_git_commands_total", "Number of git commands started during manager calls.",
+		[]string{"namespace", "operation"}, m.gitCommands)
+	writeCounter(b, "notes_push_retries_total", "Number of push attempts beyond the first one.",
+		[]string{"namespace"}, m.pushRetries)
+	writeCounter(b, "notes_merge_conflicts_total", "Number of conflicting notes met while merging remote notes.",
+		[]string{"namespace"}, m.mergeConflicts)
+	writeHistogram(b, "notes_note_size_bytes", "Size of the notes read and written.",
+		[]string{"namespace", "operation"}, m.noteSizes)
+	writeCounter(b, "notes_cache_lookups_total", "Number of lookups in note caches by result.",
+		[]string{"namespace", "result"}, m.cacheLookups)
+	return b.Flush()
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeCounter(w io.Writer, name, help string, labels []string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels, key, ""), formatValue(values[key]))
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, labels []string, values map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		h := values[key]
+		var cumulative uint64
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = formatValue(h.bounds[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(labels, key, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labels, key, ""), formatValue(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labels, key, ""), h.count)
+	}
+}
+
+// formatLabels formats the label values joined in key, with an "le" label if not empty.
+func formatLabels(labels []string, key, le string) string {
+	values := strings.Split(key, "\x00")
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		pairs = append(pairs, label+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
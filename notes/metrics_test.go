@@ -0,0 +1,158 @@
+package notes
+
+import (
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMeteredNotesManager(t *testing.T) {
+	_, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	metrics := NewMetrics()
+	manager := NewMeteredNotesManager(NewNotesManager("metered"), metrics)
+
+	if err := manager.SetNote(commitSha, "local"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	if _, err := manager.GetNote("deadbeef"); !IsInvalidCommitSha(err) {
+		t.Fatalf("Expected InvalidCommitShaError, got %v", err)
+	}
+
+	// The remote changes after the first fetch, so the first push is rejected.
+	pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+	var once sync.Once
+	restore := setGitCommandHooksForTesting(nil, func(args []string) {
+		if args[0] == "fetch" {
+			once.Do(func() { pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote changed") })
+		}
+	})
+	err := manager.PushNotesWithRetry("testorigin", 3)
+	restore()
+	if err != nil {
+		t.Fatalf("PushNotesWithRetry failed: %v", err)
+	}
+
+	// Conflicts resolved by the merge strategy are counted as well as those failing a call.
+	runCmd(t, clonePath, "git", "fetch", "origin", "+"+manager.GetRef()+":"+manager.GetRef())
+	pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote again")
+	if err := manager.SetNote(commitSha, "local again"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	merge, err := manager.FetchNotesMerge("testorigin")
+	if err != nil {
+		t.Fatalf("FetchNotesMerge failed: %v", err)
+	}
+	if !reflect.DeepEqual(merge.Conflicts, []string{commitSha}) {
+		t.Fatalf("Expected a resolved conflict, got %v", merge.Conflicts)
+	}
+	pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote once more")
+	manual := NewMeteredNotesManager(NewNotesManager("metered", WithMergeStrategy(MergeManual)), metrics)
+	if _, err := manual.FetchNotesMerge("testorigin"); !IsMergeConflict(err) {
+		t.Fatalf("Expected a merge conflict, got %v", err)
+	}
+	metrics.RecordCacheLookup("refs/notes/metered", true)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	body, _ := io.ReadAll(recorder.Body)
+	out := string(body)
+	for _, want := range []string{
+		"# TYPE notes_operations_total counter\n",
+		`notes_operations_total{namespace="refs/notes/metered",operation="SetNote"} 2` + "\n",
+		`notes_operation_errors_total{namespace="refs/notes/metered",operation="GetNote",category="invalid"} 1` + "\n",
+		`notes_operation_errors_total{namespace="refs/notes/metered",operation="FetchNotesMerge",category="conflict"} 1` + "\n",
+		"# TYPE notes_operation_duration_seconds histogram\n",
+		`notes_operation_duration_seconds_bucket{namespace="refs/notes/metered",operation="PushNotesWithRetry",le="+Inf"} 1` + "\n",
+		`notes_operation_duration_seconds_count{namespace="refs/notes/metered",operation="PushNotesWithRetry"} 1` + "\n",
+		`notes_push_retries_total{namespace="refs/notes/metered"} 1` + "\n",
+		`notes_merge_conflicts_total{namespace="refs/notes/metered"} 3` + "\n",
+		`notes_note_size_bytes_bucket{namespace="refs/notes/metered",operation="SetNote",le="64"} 2` + "\n",
+		`notes_note_size_bytes_sum{namespace="refs/notes/metered",operation="SetNote"} 16` + "\n",
+		`notes_cache_lookups_total{namespace="refs/notes/metered",result="hit"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `notes_git_commands_total{namespace="refs/notes/metered",operation="SetNote"} 0`) {
+		t.Error("Expected git commands to be counted")
+	}
+
+	t.Run("PushNotesRetries", func(t *testing.T) {
+		metrics := NewMetrics()
+		manager := NewMeteredNotesManager(NewNotesManager("metered", WithRetryPolicy(RetryPolicy{MaxAttempts: 3})), metrics)
+		if err := manager.SetNote(commitSha, "local retried"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+
+		// The remote changes after the first fetch, so the first push is rejected.
+		var once sync.Once
+		restore := setGitCommandHooksForTesting(nil, func(args []string) {
+			if args[0] == "fetch" {
+				once.Do(func() { pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote retried") })
+			}
+		})
+		err := manager.PushNotes("testorigin")
+		restore()
+		if err != nil {
+			t.Fatalf("PushNotes failed: %v", err)
+		}
+
+		recorder := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		if want := `notes_push_retries_total{namespace="refs/notes/metered"} 1` + "\n"; !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, recorder.Body.String())
+		}
+	})
+
+	t.Run("ConcurrentGitCommands", func(t *testing.T) {
+		metrics := NewMetrics()
+		get := NewMeteredNotesManager(NewNotesManager("metered"), metrics)
+		list := NewMeteredNotesManager(NewNotesManager("metered"), metrics)
+
+		// The other call runs all its commands while GetNote is in progress.
+		getStarted, listDone := make(chan struct{}), make(chan struct{})
+		var once sync.Once
+		restore := setGitCommandHooksForTesting(func(args []string) {
+			if args[0] == "notes" && slices.Contains(args, "show") {
+				once.Do(func() { close(getStarted) })
+				<-listDone
+			}
+		}, nil)
+		defer restore()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := get.GetNote(commitSha); err != nil {
+				t.Errorf("GetNote failed: %v", err)
+			}
+		}()
+		<-getStarted
+		if _, err := list.GetNoteList(); err != nil {
+			t.Fatalf("GetNoteList failed: %v", err)
+		}
+		close(listDone)
+		wg.Wait()
+
+		recorder := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		if want := `notes_git_commands_total{namespace="refs/notes/metered",operation="GetNote"} 1` + "\n"; !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, recorder.Body.String())
+		}
+	})
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if got := escapeLabelValue("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("Unexpected escaped value %q", got)
+	}
+}
@@ -0,0 +1,330 @@
+package notes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMirrorInterval is the period of MirrorNotesContinuously when not configured otherwise.
+const DefaultMirrorInterval = 5 * time.Minute
+
+// MirrorPolicy controls how MirrorNotes updates the destination when it differs from the source.
+type MirrorPolicy int
+
+const (
+	// MirrorMerge merges source notes into the destination notes with the merge strategy of
+	// MirrorOptions.Options, keeping notes that exist only on the destination.
+	MirrorMerge MirrorPolicy = iota
+	// MirrorOverwrite makes the destination notes ref equal to the source one, discarding
+	// destination-only notes.
+	MirrorOverwrite
+	// MirrorFastForwardOnly updates the destination only when that is a fast-forward and otherwise
+	// just reports the divergence.
+	MirrorFastForwardOnly
+)
+
+// Divergence describes how the source and destination notes refs relate before mirroring.
+type Divergence string
+
+const (
+	InSync               Divergence = "in_sync"
+	SourceAhead          Divergence = "source_ahead"
+	DestinationAhead     Divergence = "destination_ahead"
+	Diverged             Divergence = "diverged"
+	MissingOnSource      Divergence = "missing_on_source"
+	MissingOnDestination Divergence = "missing_on_destination"
+)
+
+// MirrorOptions configures MirrorNotes.
+type MirrorOptions struct {
+	Policy MirrorPolicy
+	// Options configure the merge of MirrorMerge, e.g. WithMergeStrategy or WithMergeFunc. The hooks
+	// of WithCommandHooks are called for every git command run, with the mirrored ref as Namespace.
+	Options []Option
+	// DryRun reports the divergence and the would-be destination tips without pushing.
+	DryRun bool
+	// RetryPolicy retries the mirroring of a notes ref, e.g. when the destination moved while it
+	// was being mirrored. The zero value means DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+	// Interval is the period of MirrorNotesContinuously. Zero means DefaultMirrorInterval.
+	Interval time.Duration
+	// OnMirror, if set, is called by MirrorNotesContinuously after every run.
+	OnMirror func(*MirrorResult, error)
+}
+
+// MirrorResult reports a MirrorNotes run.
+type MirrorResult struct {
+	Source      string
+	Destination string
+	Refs        []MirrorRefResult
+}
+
+// MirrorRefResult reports the mirroring of a single notes ref.
+type MirrorRefResult struct {
+	Ref string
+	// SourceTip and DestinationTip are the tips before mirroring ("" if the ref is missing).
+	SourceTip      string
+	DestinationTip string
+	Divergence     Divergence
+	// SourceOnly and DestinationOnly count the notes commits reachable from one tip but not the other.
+	SourceOnly      int
+	DestinationOnly int
+	// NewDestinationTip is the destination tip after mirroring (or the planned one for a dry run).
+	NewDestinationTip string
+	// Merge describes the merge made for MirrorMerge when the refs diverged.
+	Merge *MergeResult
+	// Pushed reports whether the destination was updated.
+	Pushed      bool
+	RefStatuses []PushRefStatus
+	// Err is the error that prevented mirroring this ref.
+	Err error
+}
+
+// MirrorNotes fetches the notes refs of namespaces from src, compares them with those of dst and
+// updates dst according to opts.Policy. namespaces may include AllNamespaces, which mirrors every
+// notes ref found on either remote. Local notes refs are not modified; merges are made on scratch
+// refs. Refs that fail are reported in the result and collected in the returned *BulkError.
+func MirrorNotes(src, dst Remote, namespaces []string, opts MirrorOptions) (*MirrorResult, error) {
+	if err := src.validate(); err != nil {
+		return nil, err
+	}
+	if err := dst.validate(); err != nil {
+		return nil, err
+	}
+	if src.target() == dst.target() {
+		return nil, fmt.Errorf("source and destination are the same remote '%s'", src)
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("namespaces cannot be empty")
+	}
+	policy := opts.RetryPolicy
+	if policy.MaxAttempts == 0 {
+		policy = DefaultRetryPolicy()
+	}
+
+	refs, err := mirrorRefs(newNotesManager(AllNamespaces, opts.Options...).gitContext(), src, dst, namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MirrorResult{Source: src.String(), Destination: dst.String()}
+	failures := make(map[string]error)
+	for _, ref := range refs {
+		var refResult MirrorRefResult
+		_, err := policy.run("mirror", ref, func() error {
+			var err error
+			refResult, err = mirrorRef(src, dst, ref, opts)
+			return err
+		})
+		if err != nil {
+			refResult.Err = err
+			failures[ref] = fmt.Errorf("failed to mirror %s from '%s' to '%s': %w", ref, src, dst, err)
+		}
+		result.Refs = append(result.Refs, refResult)
+	}
+	return result, newBulkError("mirror", len(refs), failures)
+}
+
+// MirrorNotesContinuously runs MirrorNotes every opts.Interval until ctx is done, passing each
+// outcome to opts.OnMirror. Failed runs do not stop it. It returns ctx.Err().
+func MirrorNotesContinuously(ctx context.Context, src, dst Remote, namespaces []string, opts MirrorOptions) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultMirrorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		result, err := MirrorNotes(src, dst, namespaces, opts)
+		if opts.OnMirror != nil {
+			opts.OnMirror(result, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return ctx.Err()
+}
+
+// mirrorRefs expands namespaces into the sorted notes refs to mirror.
+func mirrorRefs(ctx context.Context, src, dst Remote, namespaces []string) ([]string, error) {
+	set := make(map[string]bool)
+	all := false
+	for _, namespace := range namespaces {
+		if namespace == AllNamespaces {
+			all = true
+			continue
+		}
+		set[formatNamespaceRef(namespace)] = true
+	}
+	if all {
+		for _, remote := range []Remote{src, dst} {
+			tips, err := lsRemoteNotes(ctx, remote, AllNamespaces)
+			if err != nil {
+				return nil, err
+			}
+			for ref := range tips {
+				set[ref] = true
+			}
+		}
+	}
+
+	refs := make([]string, 0, len(set))
+	for ref := range set {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// lsRemoteNotes returns the tips of the remote refs matching patterns, keyed by ref.
+func lsRemoteNotes(ctx context.Context, remote Remote, patterns ...string) (map[string]string, error) {
+	output, stderr, err := remote.git(ctx, append([]string{"ls-remote", remote.target()}, patterns...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes refs on remote '%s': %w; stderr: %s", remote, err, stderr)
+	}
+	tips := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// Output of `git ls-remote` is "<sha>\t<ref>"
+		if sha, ref, found := strings.Cut(scanner.Text(), "\t"); found {
+			tips[ref] = sha
+		}
+	}
+	return tips, scanner.Err()
+}
+
+// fetchMirrorTip fetches ref from remote into its remote-tracking ref and returns the fetched tip,
+// or "" if the remote does not have ref.
+func fetchMirrorTip(ctx context.Context, remote Remote, ref string) (string, error) {
+	tips, err := lsRemoteNotes(ctx, remote, ref)
+	if err != nil {
+		return "", err
+	}
+	if tips[ref] == "" {
+		return "", nil
+	}
+	trackingRef, err := buildRemoteTrackingRef(remote, ref)
+	if err != nil {
+		return "", err
+	}
+	// The tracking ref mirrors the remote exactly, even if the remote was rewritten.
+	if _, stderr, err := remote.git(ctx, "fetch", remote.target(), "+"+ref+":"+trackingRef); err != nil {
+		return "", fmt.Errorf("failed to fetch %s from remote '%s': %w; stderr: %s", ref, remote, err, stderr)
+	}
+	return refTip(ctx, trackingRef), nil
+}
+
+func mirrorRef(src, dst Remote, ref string, opts MirrorOptions) (MirrorRefResult, error) {
+	m := newNotesManager(ref, opts.Options...)
+	ctx := m.gitContext()
+	result := MirrorRefResult{Ref: ref}
+	var err error
+	if result.SourceTip, err = fetchMirrorTip(ctx, src, ref); err != nil {
+		return result, err
+	}
+	if result.DestinationTip, err = fetchMirrorTip(ctx, dst, ref); err != nil {
+		return result, err
+	}
+	if err := result.compare(ctx); err != nil {
+		return result, err
+	}
+	result.NewDestinationTip = result.DestinationTip
+
+	var newTip string
+	force := false
+	switch result.Divergence {
+	case InSync, MissingOnSource:
+		return result, nil
+	case SourceAhead, MissingOnDestination:
+		newTip = result.SourceTip
+	case DestinationAhead, Diverged:
+		switch opts.Policy {
+		case MirrorOverwrite:
+			newTip, force = result.SourceTip, true
+		case MirrorMerge:
+			if result.Divergence == DestinationAhead {
+				return result, nil
+			}
+			merge, err := m.simulateMerge(result.DestinationTip, result.SourceTip)
+			if err != nil {
+				return result, err
+			}
+			result.Merge = merge
+			newTip = merge.NewTip
+		default:
+			return result, nil
+		}
+	}
+
+	result.NewDestinationTip = newTip
+	if opts.DryRun {
+		return result, nil
+	}
+
+	args := []string{"push", "--porcelain"}
+	if force {
+		// Only overwrite the destination tip that was compared against.
+		args = append(args, fmt.Sprintf("--force-with-lease=%s:%s", ref, result.DestinationTip))
+	}
+	args = append(args, dst.target(), fmt.Sprintf("%s:%s", newTip, ref))
+	pushStdout, pushStderr, pushErr := dst.git(ctx, args...)
+	result.RefStatuses = parsePushPorcelain(pushStdout)
+	pushErr = dst.rejectedPushError(result.RefStatuses, pushErr)
+	if pushErr != nil {
+		result.NewDestinationTip = result.DestinationTip
+		return result, fmt.Errorf("failed to push %s to remote '%s': %w; stderr: %s", ref, dst, pushErr, pushStderr)
+	}
+	result.Pushed = true
+	if trackingRef, err := buildRemoteTrackingRef(dst, ref); err == nil {
+		_, _, _ = executeGitCommandContext(ctx, "update-ref", trackingRef, newTip)
+	}
+	return result, nil
+}
+
+// compare sets the divergence of the source and destination tips.
+func (r *MirrorRefResult) compare(ctx context.Context) error {
+	switch {
+	case r.SourceTip == "" && r.DestinationTip == "":
+		r.Divergence = InSync
+		return nil
+	case r.SourceTip == "":
+		r.Divergence = MissingOnSource
+		return nil
+	case r.DestinationTip == "":
+		r.Divergence = MissingOnDestination
+		return nil
+	case r.SourceTip == r.DestinationTip:
+		r.Divergence = InSync
+		return nil
+	}
+
+	output, stderr, err := executeGitCommandContext(ctx, "rev-list", "--left-right", "--count", r.SourceTip+"..."+r.DestinationTip)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s and %s (stderr: %s): %w", r.SourceTip, r.DestinationTip, stderr, err)
+	}
+	counts := strings.Fields(output)
+	if len(counts) != 2 {
+		return fmt.Errorf("unexpected rev-list output %q", output)
+	}
+	r.SourceOnly, _ = strconv.Atoi(counts[0])
+	r.DestinationOnly, _ = strconv.Atoi(counts[1])
+
+	switch {
+	case r.DestinationOnly == 0:
+		r.Divergence = SourceAhead
+	case r.SourceOnly == 0:
+		r.Divergence = DestinationAhead
+	default:
+		r.Divergence = Diverged
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package notes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrorNotes(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	otherSha := createTestCommit(t, localPath, "mirror.txt", "mirror", "Mirror commit")
+	backupPath := t.TempDir()
+	runCmd(t, backupPath, "git", "init", "--bare")
+	runCmd(t, localPath, "git", "push", backupPath, "main")
+
+	src, dst := NamedRemote("testorigin"), RemoteURL(backupPath)
+	manager := NewNotesManager("mirror")
+	ref := manager.GetRef()
+	if err := manager.SetNote(commitSha, "original"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	if err := manager.PushNotes("testorigin"); err != nil {
+		t.Fatalf("PushNotes failed: %v", err)
+	}
+	localTip := refTip(context.Background(), ref)
+
+	remoteTip := func(t *testing.T, remote string) string {
+		t.Helper()
+		out, _ := runCmd(t, localPath, "git", "ls-remote", remote, ref)
+		return strings.Fields(out + " ")[0]
+	}
+	mirror := func(t *testing.T, opts MirrorOptions) MirrorRefResult {
+		t.Helper()
+		result, err := MirrorNotes(src, dst, []string{"mirror"}, opts)
+		if err != nil {
+			t.Fatalf("MirrorNotes failed: %v", err)
+		}
+		if len(result.Refs) != 1 || result.Refs[0].Ref != ref {
+			t.Fatalf("Unexpected mirror result: %+v", result)
+		}
+		return result.Refs[0]
+	}
+
+	t.Run("CopiesMissingRefAndReportsInSync", func(t *testing.T) {
+		r := mirror(t, MirrorOptions{})
+		if r.Divergence != MissingOnDestination || !r.Pushed || remoteTip(t, backupPath) != r.SourceTip {
+			t.Fatalf("Expected the notes to be copied, got %+v", r)
+		}
+		if r := mirror(t, MirrorOptions{}); r.Divergence != InSync || r.Pushed {
+			t.Errorf("Expected the remotes to be in sync, got %+v", r)
+		}
+		if refTip(context.Background(), ref) != localTip {
+			t.Error("Expected the local notes ref to be untouched")
+		}
+	})
+
+	// Make the remotes diverge: the destination gets a note of its own, the source changes one.
+	if err := manager.SetNote(otherSha, "destination only"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	if _, err := manager.PushNotesTo(dst, 1); err != nil {
+		t.Fatalf("PushNotesTo failed: %v", err)
+	}
+	runCmd(t, clonePath, "git", "fetch", "origin", "+"+ref+":"+ref)
+	pushNoteFromClone(t, clonePath, ref, commitSha, "source change")
+	dstTip := remoteTip(t, backupPath)
+
+	t.Run("FastForwardOnlyReportsDivergence", func(t *testing.T) {
+		r := mirror(t, MirrorOptions{Policy: MirrorFastForwardOnly})
+		if r.Divergence != Diverged || r.SourceOnly != 1 || r.DestinationOnly != 1 || r.Pushed {
+			t.Errorf("Expected a reported divergence, got %+v", r)
+		}
+		if remoteTip(t, backupPath) != dstTip {
+			t.Error("Expected the destination to be untouched")
+		}
+	})
+
+	t.Run("DryRunMerge", func(t *testing.T) {
+		r := mirror(t, MirrorOptions{DryRun: true})
+		if r.Pushed || r.Merge == nil || r.NewDestinationTip == dstTip || remoteTip(t, backupPath) != dstTip {
+			t.Errorf("Expected a planned merge without push, got %+v", r)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		r := mirror(t, MirrorOptions{Policy: MirrorMerge})
+		if !r.Pushed || remoteTip(t, backupPath) != r.NewDestinationTip {
+			t.Fatalf("Expected the merge to be pushed, got %+v", r)
+		}
+		blobs, _ := listNoteBlobs(context.Background(), r.NewDestinationTip)
+		merged, _ := readNoteBlob(context.Background(), blobs[commitSha])
+		if _, ok := blobs[otherSha]; !ok || strings.TrimSpace(merged) != "source change" {
+			t.Errorf("Expected destination notes to be kept and the source change merged, got %q", merged)
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		r := mirror(t, MirrorOptions{Policy: MirrorOverwrite})
+		if r.Divergence != DestinationAhead || !r.Pushed || remoteTip(t, backupPath) != r.SourceTip {
+			t.Errorf("Expected the destination to be overwritten, got %+v", r)
+		}
+	})
+
+	t.Run("AllNamespacesContinuously", func(t *testing.T) {
+		if err := NewNotesManager("second").SetNote(commitSha, "second"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		if err := NewNotesManager("second").PushNotes("testorigin"); err != nil {
+			t.Fatalf("PushNotes failed: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		runs := 0
+		err := MirrorNotesContinuously(ctx, src, dst, []string{AllNamespaces}, MirrorOptions{
+			Interval: 50 * time.Millisecond,
+			OnMirror: func(result *MirrorResult, err error) {
+				if err != nil {
+					t.Errorf("Mirror run failed: %v", err)
+				}
+				if runs++; runs == 2 {
+					if len(result.Refs) != 2 {
+						t.Errorf("Expected both namespaces to be mirrored, got %+v", result.Refs)
+					}
+					cancel()
+				}
+			},
+		})
+		if err != context.Canceled || runs != 2 {
+			t.Errorf("Expected two runs before cancellation, got %d runs (%v)", runs, err)
+		}
+		if out, _ := runCmd(t, localPath, "git", "ls-remote", backupPath, "refs/notes/second"); out == "" {
+			t.Error("Expected the second namespace on the destination")
+		}
+	})
+}
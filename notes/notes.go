@@ -4,12 +4,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 )
 
 const (
@@ -26,21 +27,65 @@ type NotesManager interface {
 	GetNote(commitSha string) (string, error)
 	GetNoteWithContext(ctx context.Context, commitSha string) (string, error)
 	GetNotesBulk(commitShas []string) (map[string]string, map[string]error)
+	GetNotesBulkWithContext(ctx context.Context, commitShas []string) (map[string]string, error)
 	SetNote(commitSha, value string) error
 	GetNoteList() ([]string, error)
 	DeleteNote(commitSha string) error
 	FetchNotes(remoteName string) error
+	FetchNotesMerge(remoteName string) (*MergeResult, error)
+	FetchNotesWithResult(remoteName string) (*FetchResult, error)
+	FetchNotesFrom(remote Remote) (*FetchResult, error)
 	PushNotes(remoteName string) error
 	PushNotesWithRetry(remoteName string, maxRetries int) error
+	PushNotesWithResult(remoteName string, maxRetries int) (*PushResult, error)
+	PushNotesTo(remote Remote, maxRetries int) (*PushResult, error)
+	FlushPending() error
+	PendingPushes() ([]PendingPush, error)
 }
 
 type notesManager struct {
-	ref string
+	ref           string
+	mergeStrategy MergeStrategy
+	mergeFunc     MergeFunc
+	fetchMode     FetchMode
+	retryPolicy   RetryPolicy
+	dryRun        bool
+	onPlan        func(*Plan)
+	outbox        *outboxState
+	lockConfig    LockConfig
+
+	annotatedCommits     AnnotatedCommitsConfig
+	missingRefAsEmpty    bool
+	missingNotesAsAbsent bool
+	// identityEnv sets the author and committer of the notes commits made by the manager.
+	identityEnv []string
+
+	// hooks are called for every git command run by the manager.
+	hooks *CommandHooks
+	// ctx is the context calls without a context argument run their git commands with; it carries
+	// the git command listeners of the decorators wrapping the manager. nil means context.Background().
+	ctx context.Context
 }
 
+// Option configures optional behavior of a notes manager.
+type Option func(*notesManager)
+
 // NewNotesManager creates a new notes manager for the given namespace
-func NewNotesManager(namespace string) NotesManager {
-	return &notesManager{ref: formatNamespaceRef(namespace)}
+func NewNotesManager(namespace string, opts ...Option) NotesManager {
+	return newNotesManager(namespace, opts...)
+}
+
+func newNotesManager(namespace string, opts ...Option) *notesManager {
+	m := &notesManager{
+		ref:           formatNamespaceRef(namespace),
+		mergeStrategy: MergeCatSortUniq,
+		retryPolicy:   DefaultRetryPolicy(),
+		lockConfig:    DefaultLockConfig(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // GetRef returns the ref of the notes manager
@@ -48,13 +93,76 @@ func (m *notesManager) GetRef() string {
 	return m.ref
 }
 
+// contextBinder is implemented by the managers of this package. A bound copy of a manager runs the
+// git commands of its calls with the context it was bound to, which carries the git command
+// listeners of the decorators wrapping it.
+type contextBinder interface {
+	withContext(ctx context.Context) NotesManager
+}
+
+// bindContext returns manager bound to ctx, or manager itself if it cannot be bound.
+func bindContext(manager NotesManager, ctx context.Context) NotesManager {
+	if binder, ok := manager.(contextBinder); ok {
+		return binder.withContext(ctx)
+	}
+	return manager
+}
+
+// callContext returns ctx, or context.Background() if ctx is nil.
+func callContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+func (m *notesManager) withContext(ctx context.Context) NotesManager {
+	bound := *m
+	bound.ctx = ctx
+	return &bound
+}
+
+// gitContext returns the context the git commands of a call without a context argument run with.
+func (m *notesManager) gitContext() context.Context {
+	return m.hookContext(callContext(m.ctx))
+}
+
+// hookContext returns ctx with the manager's command hooks.
+func (m *notesManager) hookContext(ctx context.Context) context.Context {
+	if m.hooks == nil {
+		return ctx
+	}
+	return withCommandHooks(ctx, m.ref, m.hooks)
+}
+
+// WithIdentity makes the manager record name and email as the author and committer of the notes
+// commits it creates. By default the identity configured in git (user.name and user.email, or the
+// GIT_AUTHOR_* and GIT_COMMITTER_* environment variables) is used, or "Library Notes
+// <lib@example.com>" if git has none.
+func WithIdentity(name, email string) Option {
+	return func(m *notesManager) {
+		m.identityEnv = []string{
+			"GIT_AUTHOR_NAME=" + name,
+			"GIT_AUTHOR_EMAIL=" + email,
+			"GIT_COMMITTER_NAME=" + name,
+			"GIT_COMMITTER_EMAIL=" + email,
+		}
+	}
+}
+
+// git runs a git command for a call of the manager.
+func (m *notesManager) git(args ...string) (string, string, error) {
+	return runGitCommand(m.gitContext(), nil, m.identityEnv, args...)
+}
+
 // GetNote retrieves the content of a note for a specific commit SHA in a namespace.
 func (m *notesManager) GetNote(commitSha string) (string, error) {
-	return m.GetNoteWithContext(context.Background(), commitSha)
+	return m.GetNoteWithContext(m.gitContext(), commitSha)
 }
 
 // GetNoteWithContext retrieves the content of a note with context support for cancellation
 func (m *notesManager) GetNoteWithContext(ctx context.Context, commitSha string) (string, error) {
+	ctx = m.hookContext(ctx)
 	if err := validateCommitSHA(commitSha); err != nil {
 		return "", err
 	}
@@ -73,29 +181,55 @@ func (m *notesManager) GetNoteWithContext(ctx context.Context, commitSha string)
 			return "", ctx.Err()
 		}
 
-		errStr := err.Error()
-		if errorMatcher.IsNoteNotFoundError(errStr, stderr) {
-			return "", &NoteNotFoundError{Ref: m.ref, CommitSha: commitSha}
+		// `git notes show` exits with 1 when the object has no note and with 128 when it cannot
+		// resolve the object.
+		if gitExitCode(err) == 1 {
+			return "", &NoteNotFoundError{Ref: m.ref, CommitSha: commitSha, Err: err}
 		}
-
-		if errorMatcher.IsInvalidCommitError(errStr) {
-			return "", &InvalidCommitShaError{CommitSha: commitSha}
+		if repoErr := checkRepository(ctx); repoErr != nil {
+			return "", repoErr
+		}
+		if _, _, resolveErr := executeGitCommandContext(ctx, "rev-parse", "--verify", "--quiet", commitSha+"^{object}"); resolveErr != nil {
+			return "", &InvalidCommitShaError{CommitSha: commitSha, Err: err}
 		}
 
-		return "", fmt.Errorf("failed to get note for %s in %s: %w", commitSha, m.ref, err)
+		return "", fmt.Errorf("failed to get note for %s in %s (stderr: %s): %w", commitSha, m.ref, stderr, err)
 	}
 	return stdout, nil
 }
 
+// WithMissingNotesAsAbsent makes GetNotesBulk and GetNotesBulkWithContext leave commits without
+// notes out of the results instead of reporting them as failures.
+func WithMissingNotesAsAbsent() Option {
+	return func(m *notesManager) {
+		m.missingNotesAsAbsent = true
+	}
+}
+
 // GetNotesBulk retrieves notes for multiple commit SHAs in parallel
 func (m *notesManager) GetNotesBulk(commitShas []string) (map[string]string, map[string]error) {
+	return m.getNotesBulk(m.gitContext(), commitShas)
+}
+
+// GetNotesBulkWithContext is like GetNotesBulk but stops starting new lookups once ctx is done and
+// reports the failures, including the commits abandoned because of ctx, as a *BulkError.
+// The notes retrieved are returned even when some lookups failed.
+func (m *notesManager) GetNotesBulkWithContext(ctx context.Context, commitShas []string) (map[string]string, error) {
+	results, failures := m.getNotesBulk(m.hookContext(ctx), commitShas)
+	return results, newBulkError("get notes", len(commitShas), failures)
+}
+
+func (m *notesManager) getNotesBulk(ctx context.Context, commitShas []string) (map[string]string, map[string]error) {
 	results := make(map[string]string)
 	errors := make(map[string]error)
 
-	// Validate all SHAs first
+	// Validate all SHAs first. The goroutines below write errors, so the invalid SHAs are also
+	// kept in a set of their own that is only read afterwards.
+	invalid := make(map[string]bool)
 	for _, sha := range commitShas {
 		if err := validateCommitSHA(sha); err != nil {
 			errors[sha] = err
+			invalid[sha] = true
 		}
 	}
 
@@ -105,22 +239,30 @@ func (m *notesManager) GetNotesBulk(commitShas []string) (map[string]string, map
 	var mu sync.Mutex
 
 	for _, sha := range commitShas {
-		if _, hasError := errors[sha]; hasError {
+		if invalid[sha] {
 			continue // Skip invalid SHAs
 		}
 
 		wg.Add(1)
 		go func(commitSha string) {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
+			var note string
+			var err error
+			select {
+			case sem <- struct{}{}:
+				note, err = m.GetNoteWithContext(ctx, commitSha)
+				<-sem
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
 
-			note, err := m.GetNote(commitSha)
 			mu.Lock()
-			if err != nil {
-				errors[commitSha] = err
-			} else {
+			switch {
+			case err == nil:
 				results[commitSha] = note
+			case m.missingNotesAsAbsent && IsNoteNotFound(err):
+			default:
+				errors[commitSha] = err
 			}
 			mu.Unlock()
 		}(sha)
@@ -142,7 +284,7 @@ func (m *notesManager) SetNote(commitSha, value string) error {
 
 	if commitSha == "" {
 		var err error
-		commitSha, _, err = executeGitCommand("rev-parse", "HEAD")
+		commitSha, _, err = m.git("rev-parse", "HEAD")
 		if err != nil {
 			return fmt.Errorf("failed to resolve HEAD: %w", err)
 		}
@@ -153,13 +295,25 @@ func (m *notesManager) SetNote(commitSha, value string) error {
 		return m.DeleteNote(commitSha)
 	}
 
-	stdout, stderr, err := executeGitCommand(
-		"notes", "--ref", m.ref, "add", "-f", "-m", value, commitSha,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to set note for %s in %s (stdout: %s | stderr: %s): %w", commitSha, m.ref, stdout, stderr, err)
+	if m.dryRun {
+		return m.dryRunNoteUpdate(commitSha, value)
 	}
-	return nil
+	m.maybeFlushPending("")
+
+	// git updates the notes ref only if it still points to the commit the new note was based on,
+	// so concurrent writers make this fail with a lock error, which the retry policy retries.
+	_, err := m.retryPolicy.run("update", m.ref, func() error {
+		return m.withRepoLock(func() error {
+			stdout, stderr, err := m.git(
+				"notes", "--ref", m.ref, "add", "-f", "-m", value, commitSha,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to set note for %s in %s (stdout: %s | stderr: %s): %w", commitSha, m.ref, stdout, stderr, err)
+			}
+			return nil
+		})
+	})
+	return err
 }
 
 // Helper struct to hold commit SHA and its timestamp
@@ -168,15 +322,31 @@ type commitInfo struct {
 	Timestamp int64
 }
 
+// WithMissingRefAsEmpty makes GetNoteList return an empty list instead of a NotesRefNotFoundError
+// for a namespace that has no notes ref yet.
+func WithMissingRefAsEmpty() Option {
+	return func(m *notesManager) {
+		m.missingRefAsEmpty = true
+	}
+}
+
 // GetNoteList retrieves a list of commit SHAs that have notes in a given namespace,
 // sorted in reverse chronological order (newest first).
+// It returns a NotesRefNotFoundError if the namespace has no notes ref, unless the manager was
+// created with WithMissingRefAsEmpty, and a NotARepositoryError outside a git repository.
 func (m *notesManager) GetNoteList() ([]string, error) {
-	listOutput, _, err := executeGitCommand("notes", "--ref", m.ref, "list")
+	exists, err := verifyRef(m.gitContext(), m.ref)
 	if err != nil {
-		errMsg := err.Error()
-		if errorMatcher.IsNotesRefNotFoundError(errMsg) {
+		return nil, err
+	}
+	if !exists {
+		if m.missingRefAsEmpty {
 			return []string{}, nil
 		}
+		return nil, &NotesRefNotFoundError{Ref: m.ref}
+	}
+	listOutput, _, err := m.git("notes", "--ref", m.ref, "list")
+	if err != nil {
 		return nil, fmt.Errorf("failed to list notes in %s: %w", m.ref, err)
 	}
 
@@ -210,7 +380,7 @@ func (m *notesManager) GetNoteList() ([]string, error) {
 
 	// Get all timestamps in one batch call
 	args := append([]string{"show", "-s", "--format=%H %ct"}, commitShas...)
-	timestampOutput, _, err := executeGitCommand(args...)
+	timestampOutput, _, err := m.git(args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get timestamps for commits: %w", err)
 	}
@@ -255,205 +425,350 @@ func (m *notesManager) DeleteNote(commitSha string) error {
 		return err
 	}
 
-	_, stderr, err := executeGitCommand("notes", "--ref", m.ref, "remove", commitSha)
-	if err != nil {
-		// Check if the note doesn't exist (not an error in delete context)
-		if errorMatcher.IsDeleteNoteNotFoundError(stderr, err.Error()) {
-			return nil // Idempotent delete
-		}
-		return fmt.Errorf("failed to delete note for %s in %s (stderr: %s): %w", commitSha, m.ref, stderr, err)
+	if m.dryRun {
+		return m.dryRunNoteUpdate(commitSha, "")
+	}
+	m.maybeFlushPending("")
+
+	_, err := m.retryPolicy.run("update", m.ref, func() error {
+		return m.withRepoLock(func() error {
+			// --ignore-missing makes deleting a note that does not exist a no-op.
+			_, stderr, err := m.git("notes", "--ref", m.ref, "remove", "--ignore-missing", commitSha)
+			if err != nil {
+				return fmt.Errorf("failed to delete note for %s in %s (stderr: %s): %w", commitSha, m.ref, stderr, err)
+			}
+			return nil
+		})
+	})
+	return err
+}
+
+// FetchMode controls how FetchNotes reconciles remote notes with the local notes ref.
+type FetchMode int
+
+const (
+	// FetchMerge fetches remote notes into the remote-tracking ref and merges them into the local
+	// notes ref with the manager's merge strategy, keeping notes that have not been pushed yet.
+	FetchMerge FetchMode = iota
+	// FetchForce overwrites the local notes ref with the remote one, discarding local-only notes.
+	FetchForce
+)
+
+// WithFetchMode sets how FetchNotes updates the local notes ref. The default is FetchMerge.
+func WithFetchMode(mode FetchMode) Option {
+	return func(m *notesManager) {
+		m.fetchMode = mode
 	}
-	return nil
 }
 
-// FetchNotes fetches notes from a remote for a specific namespace and attempts to update the local notes ref.
-// It uses `git fetch --force <remoteName> <refSpec>:<refSpec>` to overwrite local changes if divergence occurs.
+// FetchNotes fetches notes from a remote for a specific namespace and updates the local notes ref
+// according to the manager's FetchMode. By default remote notes are merged into the local ones;
+// with FetchForce it uses `git fetch --force <remoteName> <refSpec>:<refSpec>` to overwrite local
+// changes if divergence occurs.
 func (m *notesManager) FetchNotes(remoteName string) error {
-	if remoteName == "" {
-		return fmt.Errorf("remoteName cannot be empty")
+	_, err := m.FetchNotesWithResult(remoteName)
+	return err
+}
+
+// FetchNotesWithResult is like FetchNotes but reports the local and remote tips before and after
+// the fetch and the notes changed by the merge.
+func (m *notesManager) FetchNotesWithResult(remoteName string) (*FetchResult, error) {
+	return m.FetchNotesFrom(resolveRemote(m.gitContext(), remoteName))
+}
+
+// FetchNotesFrom is like FetchNotesWithResult but takes a Remote, which may be a URL and may carry
+// its own environment, configuration overrides and timeout.
+func (m *notesManager) FetchNotesFrom(remote Remote) (*FetchResult, error) {
+	if err := remote.validate(); err != nil {
+		return nil, err
 	}
-	// The refspec fetches the remote notes ref and updates the local one with the same name.
-	// e.g., refs/notes/mynamespace:refs/notes/mynamespace
-	fullRefSpec := fmt.Sprintf("%s:%s", m.ref, m.ref)
+	if m.dryRun {
+		return m.dryRunFetch(remote, m.fetchMode == FetchForce)
+	}
+	m.maybeFlushPending("")
+	if m.fetchMode == FetchForce {
+		return m.fetchNotesForce(remote)
+	}
+	return m.fetchNotesMerge(remote)
+}
 
-	// 1. Fetch the notes reference itself
-	_, stderrOutput, err := executeGitCommand("fetch", "--force", remoteName, fullRefSpec)
+// FetchNotesMerge fetches notes from a remote into the remote-tracking ref and merges them into the
+// local notes ref with the manager's merge strategy, regardless of the configured FetchMode.
+// The returned MergeResult describes which notes the merge added, changed or removed locally;
+// it is nil if the remote has no notes for this namespace.
+func (m *notesManager) FetchNotesMerge(remoteName string) (*MergeResult, error) {
+	remote := resolveRemote(m.gitContext(), remoteName)
+	if err := remote.validate(); err != nil {
+		return nil, err
+	}
+	var result *FetchResult
+	var err error
+	if m.dryRun {
+		result, err = m.dryRunFetch(remote, false)
+	} else {
+		m.maybeFlushPending("")
+		result, err = m.fetchNotesMerge(remote)
+	}
 	if err != nil {
-		// Check if the error is because the remote ref doesn't exist
-		if errorMatcher.IsRemoteRefNotFoundError(stderrOutput, err.Error()) {
-			// Remote doesn't have this notes ref yet, not an error
-			return nil
-		}
-		return fmt.Errorf("failed to fetch notes for namespace %s (refspec %s) from %s (stderr: %s): %w",
-			m.ref, fullRefSpec, remoteName, stderrOutput, err)
-	}
-
-	// 2. After fetching notes, list all commits referenced by these notes.
-	// The original code proceeds even if listing notes fails or returns empty,
-	// so we'll maintain that behavior for this part.
-	listOutput, _, listErr := executeGitCommand("notes", "--ref", m.ref, "list")
-
-	// Only proceed if listing notes was successful and produced output.
-	if listErr == nil && listOutput != "" {
-		scanner := bufio.NewScanner(strings.NewReader(listOutput))
-		// Using a map to store commitShas ensures uniqueness efficiently.
-		commitShasToFetch := make(map[string]struct{})
-
-		for scanner.Scan() {
-			parts := strings.Fields(scanner.Text())
-			// Output of `git notes list` is typically "<note-object-sha> <commit-sha>"
-			if len(parts) >= 2 {
-				commitSha := parts[1]
-				commitShasToFetch[commitSha] = struct{}{}
-			}
-		}
+		return nil, err
+	}
+	return result.Merge, nil
+}
 
-		// 3. If there are any commit SHAs referenced by the notes, fetch them all in a single command.
-		if len(commitShasToFetch) > 0 {
-			// Convert map keys to a slice of SHAs for the command arguments.
-			shas := make([]string, 0, len(commitShasToFetch))
-			for sha := range commitShasToFetch {
-				shas = append(shas, sha)
-			}
+func (m *notesManager) fetchNotesMerge(remote Remote) (*FetchResult, error) {
+	remoteTrackingRef, err := buildRemoteTrackingRef(remote, m.ref)
+	if err != nil {
+		return nil, err
+	}
+	result := &FetchResult{
+		Ref:               m.ref,
+		RemoteTrackingRef: remoteTrackingRef,
+		OldLocalTip:       refTip(m.gitContext(), m.ref),
+		OldRemoteTip:      refTip(m.gitContext(), remoteTrackingRef),
+	}
+	result.NewLocalTip = result.OldLocalTip
+
+	// The repository lock is held per attempt, so other writers can proceed during backoff.
+	var remoteNotesExist bool
+	_, err = m.retryPolicy.run("fetch", m.ref, func() error {
+		return m.withRepoLock(func() error {
+			var err error
+			_, remoteNotesExist, err = m.fetchRemoteTrackingRef(remote)
+			return err
+		})
+	})
+	if err != nil || !remoteNotesExist {
+		return result, err
+	}
+	result.NewRemoteTip = refTip(m.gitContext(), remoteTrackingRef)
 
-			// Prepare arguments for `git fetch <remoteName> <sha1> <sha2> ...`
-			fetchArgs := []string{"fetch", remoteName}
-			fetchArgs = append(fetchArgs, shas...)
-			_, _, _ = executeGitCommand(fetchArgs...)
+	err = m.withRepoLock(func() error {
+		var err error
+		if result.Merge, err = m.mergeRemoteNotes(remoteTrackingRef); err != nil {
+			return err
 		}
+		result.NewLocalTip = result.Merge.NewTip
+		return nil
+	})
+	if err != nil {
+		return result, err
 	}
-	// If listErr was not nil or listOutput was empty, the block above is skipped.
-	// The function returns nil, indicating success for the primary operation of fetching the notes ref,
-	// consistent with the original function's behavior.
-	return nil
+
+	result.AnnotatedCommits = m.fetchAnnotatedCommits(remote)
+	return result, nil
+}
+
+// fetchNotesForce overwrites the local notes ref with the remote one.
+func (m *notesManager) fetchNotesForce(remote Remote) (*FetchResult, error) {
+	result := &FetchResult{Ref: m.ref, OldLocalTip: refTip(m.gitContext(), m.ref), Forced: true}
+	result.NewLocalTip = result.OldLocalTip
+
+	// The refspec fetches the remote notes ref and updates the local one with the same name.
+	// e.g., refs/notes/mynamespace:refs/notes/mynamespace
+	fullRefSpec := fmt.Sprintf("%s:%s", m.ref, m.ref)
+
+	// 1. Fetch the notes reference itself, holding the repository lock per attempt.
+	remoteNotesExist := true
+	_, err := m.retryPolicy.run("fetch", m.ref, func() error {
+		return m.withRepoLock(func() error {
+			// A remote that doesn't have this notes ref yet is not an error.
+			var stderrOutput string
+			var err error
+			remoteNotesExist, stderrOutput, err = remote.fetchRef(m.gitContext(), m.ref, "fetch", "--force", remote.target(), fullRefSpec)
+			if err != nil {
+				return fmt.Errorf("failed to fetch notes for namespace %s (refspec %s) from %s (stderr: %s): %w",
+					m.ref, fullRefSpec, remote, stderrOutput, err)
+			}
+			return nil
+		})
+	})
+	if err != nil || !remoteNotesExist {
+		return result, err
+	}
+	result.NewLocalTip = refTip(m.gitContext(), m.ref)
+	result.NewRemoteTip = result.NewLocalTip
+
+	result.AnnotatedCommits = m.fetchAnnotatedCommits(remote)
+	return result, nil
 }
 
 // PushNotes fetches remote notes for the given namespace, merges them into the local notes
-// using the 'cat_sort_uniq' strategy, and then pushes the combined result to the remote.
+// using the manager's merge strategy ('cat_sort_uniq' unless configured otherwise), and then
+// pushes the combined result to the remote, retrying according to the manager's RetryPolicy.
 func (m *notesManager) PushNotes(remoteName string) error {
-	return m.PushNotesWithRetry(remoteName, DefaultRetryAttempts)
+	return m.PushNotesWithRetry(remoteName, m.retryPolicy.MaxAttempts)
 }
 
-// PushNotesWithRetry is like PushNotes but with configurable retry attempts
+// PushNotesWithRetry is like PushNotes but with configurable retry attempts.
+// maxRetries overrides the MaxAttempts of the manager's RetryPolicy.
 func (m *notesManager) PushNotesWithRetry(remoteName string, maxRetries int) error {
-	if remoteName == "" {
-		return fmt.Errorf("remoteName cannot be empty")
+	_, err := m.PushNotesWithResult(remoteName, maxRetries)
+	return err
+}
+
+// PushNotesWithResult is like PushNotesWithRetry but reports the local and remote tips, the notes
+// changed by merging remote notes, the attempts used and the per-ref push status.
+// The result is returned even when the push fails.
+// With WithOutbox, a push that fails because the remote is unreachable is queued for replay and a
+// PushQueuedError is returned.
+func (m *notesManager) PushNotesWithResult(remoteName string, maxRetries int) (*PushResult, error) {
+	return m.PushNotesTo(resolveRemote(m.gitContext(), remoteName), maxRetries)
+}
+
+// PushNotesTo is like PushNotesWithResult but takes a Remote, which may be a URL and may carry its
+// own environment, configuration overrides and timeout.
+func (m *notesManager) PushNotesTo(remote Remote, maxRetries int) (*PushResult, error) {
+	if err := remote.validate(); err != nil {
+		return nil, err
 	}
 
+	if m.dryRun {
+		return m.dryRunPush(remote)
+	}
+
+	// Pending pushes to this remote are superseded by the push below.
+	m.maybeFlushPending(remote.target())
+	result, err := m.pushNotesWithRetry(remote, maxRetries)
+	if outboxErr := m.recordPushOutcome(remote, err); outboxErr != nil {
+		return result, errors.Join(err, outboxErr)
+	}
+	if err != nil && m.outbox != nil && IsNetworkError(err) {
+		pending, _ := m.PendingPushes()
+		return result, &PushQueuedError{Ref: m.ref, Remote: remote.String(), Pending: len(pending), Err: err}
+	}
+	return result, err
+}
+
+// pushNotesWithRetry fetches, merges and pushes the notes ref, retrying according to the manager's
+// RetryPolicy with maxRetries attempts.
+func (m *notesManager) pushNotesWithRetry(remote Remote, maxRetries int) (*PushResult, error) {
+	result := &PushResult{Ref: m.ref, OldLocalTip: refTip(m.gitContext(), m.ref)}
+
 	// There is still an unavoidable race window between fetching the remote notes ref and
 	// pushing our merged result: another collaborator can push new notes during that window.
 	// When that happens, the push attempt will fail with a non-fast-forward error. Retrying
 	// forces another fetch/merge cycle so the newly published notes are incorporated.
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		err := m.pushNotesAttempt(remoteName)
-		if err == nil {
-			return nil
-		}
-
-		// Check if error is due to non-fast-forward (concurrent modification)
-		if errorMatcher.IsPushRetryableError(err.Error()) {
-			if attempt < maxRetries-1 {
-				// log.Printf("Push failed due to concurrent modification, retry %d/%d", attempt+1, maxRetries)
-				// Exponential backoff
-				time.Sleep(time.Duration(attempt*attempt) * 100 * time.Millisecond)
-				continue
-			}
-		}
+	policy := m.retryPolicy
+	policy.MaxAttempts = maxRetries
+	// The repository lock is held per attempt, so other writers can proceed during backoff.
+	var conflicts []string
+	attempts, err := policy.run("push", m.ref, func() error {
+		return m.withRepoLock(func() error {
+			resolved, err := m.pushNotesAttempt(remote, result)
+			conflicts = append(conflicts, resolved...)
+			return err
+		})
+	})
+	result.Attempts = attempts
+	notifyPushAttempts(m.gitContext(), attempts)
+	if finishErr := m.finishPushResult(result, conflicts); err == nil {
+		err = finishErr
+	}
+	return result, err
+}
 
-		// Non-retryable error or last attempt
+// finishPushResult records the local tip reached so far and the notes merged in since the push
+// began, together with the conflicts resolved by the merges of all attempts.
+func (m *notesManager) finishPushResult(result *PushResult, conflicts []string) error {
+	result.NewLocalTip = refTip(m.gitContext(), m.ref)
+	merge, err := newMergeResult(m.gitContext(), m.effectiveMergeStrategy(), result.OldLocalTip, result.NewLocalTip)
+	if err != nil {
 		return err
 	}
+	sort.Strings(conflicts)
+	merge.Conflicts = slices.Compact(conflicts)
+	result.Merge = merge
+	return nil
+}
 
-	return fmt.Errorf("push failed after %d attempts", maxRetries)
+const (
+	// legacyTrackingRefPrefix holds remote-tracking notes refs in the older
+	// refs/notes/remotes/<remote>/... layout.
+	legacyTrackingRefPrefix = "refs/notes/remotes/"
+	// scratchRefPrefix holds the scratch refs of dry runs.
+	scratchRefPrefix = "refs/notes/dry-run-scratch/"
+)
+
+// isNamespaceRef reports whether ref, a ref under refs/notes/, is a notes namespace rather than a
+// remote-tracking ref or a scratch ref left by a dry run.
+func isNamespaceRef(ref string) bool {
+	return !strings.HasPrefix(ref, legacyTrackingRefPrefix) && !strings.HasPrefix(ref, scratchRefPrefix)
 }
 
-func buildRemoteTrackingRef(remoteName, notesRef string) (string, error) {
+func buildRemoteTrackingRef(remote Remote, notesRef string) (string, error) {
 	if !strings.HasPrefix(notesRef, "refs/notes/") {
 		return "", fmt.Errorf("internal error: localRef '%s' is not in the expected 'refs/notes/...' format", notesRef)
 	}
 	pathSuffix := strings.TrimPrefix(notesRef, "refs/")
-	return fmt.Sprintf("refs/remotes/%s/%s", remoteName, pathSuffix), nil
+	return remote.trackingRefPrefix() + pathSuffix, nil
 }
 
-// pushNotesAttempt performs a single attempt to push notes
-func (m *notesManager) pushNotesAttempt(remoteName string) error {
-	// First, ensure we're in a clean state (abort any previous merge)
-	// This is safe to run even if there's no merge in progress
-	_, _, _ = executeGitCommand("notes", "--ref", m.ref, "merge", "--abort")
-
-	// 1. Fetch remote notes. This updates the remote-tracking ref (e.g., refs/remotes/origin/notes/my_namespace).
+// fetchRemoteTrackingRef fetches the remote notes into the remote-tracking ref
+// (e.g., refs/remotes/origin/notes/my_namespace) and reports whether the remote has notes at all.
+func (m *notesManager) fetchRemoteTrackingRef(remote Remote) (string, bool, error) {
 	// We fetch the specific notes ref. If it doesn't exist on the remote, fetch will indicate this.
-	remoteTrackingRef, err := buildRemoteTrackingRef(remoteName, m.ref)
+	remoteTrackingRef, err := buildRemoteTrackingRef(remote, m.ref)
 	if err != nil {
-		return err
+		return "", false, err
 	}
 
 	fetchRefspec := fmt.Sprintf("%s:%s", m.ref, remoteTrackingRef)
-	_, fetchStderr, fetchErr := executeGitCommand("fetch", remoteName, fetchRefspec)
-
-	remoteNotesExist := true
+	exists, fetchStderr, fetchErr := remote.fetchRef(m.gitContext(), m.ref, "fetch", remote.target(), fetchRefspec)
 	if fetchErr != nil {
-		// Check if the error is because the remote ref simply doesn't exist.
-		// This is common if notes haven't been pushed to this namespace on the remote yet.
-		// `git fetch` often exits with status 1 or 128 for "ref not found".
-		if errorMatcher.IsRemoteRefNotFoundError(fetchStderr, fetchErr.Error()) {
-			remoteNotesExist = false
-		} else {
-			// A more significant fetch error occurred.
-			return fmt.Errorf("failed to fetch notes from remote '%s' for ref '%s' before merge: %w; stderr: %s",
-				remoteName, m.ref, fetchErr, fetchStderr)
-		}
+		return "", false, fmt.Errorf("failed to fetch notes from remote '%s' for ref '%s' before merge: %w; stderr: %s",
+			remote, m.ref, fetchErr, fetchStderr)
+	}
+	if !exists {
+		// Notes haven't been pushed to this namespace on the remote yet.
+		return remoteTrackingRef, false, nil
+	}
+
+	// Verify the remote-tracking ref exists (it should if fetch was successful and remote had notes)
+	_, _, errVerifyRemoteRef := m.git("rev-parse", "--verify", remoteTrackingRef)
+	return remoteTrackingRef, errVerifyRemoteRef == nil, nil
+}
+
+// pushNotesAttempt performs a single attempt to push notes and returns the conflicts resolved by
+// merging remote notes.
+func (m *notesManager) pushNotesAttempt(remote Remote, result *PushResult) ([]string, error) {
+	// 1. Fetch remote notes. This updates the remote-tracking ref.
+	remoteTrackingRef, remoteNotesExist, err := m.fetchRemoteTrackingRef(remote)
+	if err != nil {
+		return nil, err
 	}
 
+	var conflicts []string
+	result.OldRemoteTip = ""
 	if remoteNotesExist {
+		result.OldRemoteTip = refTip(m.gitContext(), remoteTrackingRef)
 
-		// Save the current local ref before merge attempt (for potential rollback)
-		localRefSHA, _, err := executeGitCommand("rev-parse", m.ref)
+		// 2. Merge fetched remote notes into local notes
+		merge, err := m.mergeRemoteNotes(remoteTrackingRef)
 		if err != nil {
-			// If local ref doesn't exist yet, that's okay
-			localRefSHA = ""
-		}
-
-		// Verify the remote-tracking ref exists (it should if fetch was successful and remote had notes)
-		_, _, errVerifyRemoteRef := executeGitCommand("rev-parse", "--verify", remoteTrackingRef)
-		if errVerifyRemoteRef == nil {
-			// 3. Merge fetched remote notes into local notes using 'cat_sort_uniq' strategy
-			_, mergeStderr, mergeErr := executeGitCommand("notes", "--ref", m.ref, "merge", "-s", "cat_sort_uniq", remoteTrackingRef)
-			if mergeErr != nil {
-				// "Already up to date" or "nothing to merge" are not errors in this context.
-				if !errorMatcher.IsMergeUpToDate(mergeStderr) {
-
-					// Abort the failed merge to clean up state
-					_, _, _ = executeGitCommand("notes", "--ref", m.ref, "merge", "--abort")
-
-					// If we had a local ref before, reset to it
-					if localRefSHA != "" {
-						_, _, _ = executeGitCommand("update-ref", m.ref, strings.TrimSpace(localRefSHA))
-					}
-
-					if errorMatcher.IsMergeConflict(mergeStderr) {
-						return fmt.Errorf("failed to automatically merge notes from '%s' into '%s' using 'cat_sort_uniq', conflict: %w; stderr: %s",
-							remoteTrackingRef, m.ref, mergeErr, mergeStderr)
-					}
-					return fmt.Errorf("failed to merge notes from '%s' into '%s': %w; stderr: %s",
-						remoteTrackingRef, m.ref, mergeErr, mergeStderr)
-				}
-			}
+			return nil, err
 		}
+		conflicts = merge.Conflicts
 	}
 
-	// 4. Push the (now potentially merged) local notes to the remote.
+	// 3. Push the (now potentially merged) local notes to the remote.
 	// This push should ideally be a fast-forward.
-	_, pushStderr, pushErr := executeGitCommand("push", remoteName, m.ref)
+	pushStdout, pushStderr, pushErr := remote.git(m.gitContext(), "push", "--porcelain", remote.target(), m.ref)
+	result.RefStatuses = parsePushPorcelain(pushStdout)
+	pushErr = remote.rejectedPushError(result.RefStatuses, pushErr)
 	if pushErr != nil {
 		// If this push still fails (e.g., non-fast-forward because someone *else* pushed notes
 		// *between* our fetch and this push), then the situation is a race condition.
 		// The user might need to re-run the operation.
-		return fmt.Errorf("failed to push merged notes ref '%s' to remote '%s': %w; stderr: %s",
-			m.ref, remoteName, pushErr, pushStderr)
+		return conflicts, fmt.Errorf("failed to push merged notes ref '%s' to remote '%s': %w; stderr: %s",
+			m.ref, remote, pushErr, pushStderr)
 	}
 
-	return nil
+	// Keep the remote-tracking ref in step with what the remote now has.
+	result.NewRemoteTip = refTip(m.gitContext(), m.ref)
+	if result.NewRemoteTip != "" {
+		_, _, _ = m.git("update-ref", remoteTrackingRef, result.NewRemoteTip)
+	}
+	return conflicts, nil
 }
 
 // SetNoteJSON serializes the given value to JSON and stores it as a git note
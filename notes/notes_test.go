@@ -68,6 +68,52 @@ func createTestCommit(t *testing.T, repoPath string, filename string, content st
 	return sha
 }
 
+// chdirForTest changes the working directory to dir for the rest of the test.
+func chdirForTest(t *testing.T, dir string) {
+	t.Helper()
+	originalCwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change CWD to %s: %v", dir, err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(originalCwd); err != nil {
+			t.Logf("Failed to restore CWD to %s: %v", originalCwd, err)
+		}
+	})
+}
+
+// setupRemoteTestRepos creates a local repository, a bare remote named "testorigin" and a
+// second clone of that remote, then switches the working directory to the local repository.
+// It returns the local, bare and clone paths along with a commit SHA present in all of them.
+func setupRemoteTestRepos(t *testing.T) (localPath, remotePath, clonePath, commitSha string) {
+	t.Helper()
+	localPath = setupTestRepo(t)
+	commitSha = createTestCommit(t, localPath, "shared.txt", "shared content", "Shared commit")
+
+	remotePath = t.TempDir()
+	runCmd(t, remotePath, "git", "init", "--bare")
+	runCmd(t, localPath, "git", "remote", "add", "testorigin", remotePath)
+	runCmd(t, localPath, "git", "push", "testorigin", "main")
+
+	clonePath = filepath.Join(t.TempDir(), "clone")
+	runCmd(t, "", "git", "clone", remotePath, clonePath)
+	runCmd(t, clonePath, "git", "config", "user.email", "test@example.com")
+	runCmd(t, clonePath, "git", "config", "user.name", "Test User")
+
+	chdirForTest(t, localPath)
+	return localPath, remotePath, clonePath, commitSha
+}
+
+// pushNoteFromClone writes a note in the clone and pushes it to its origin.
+func pushNoteFromClone(t *testing.T, clonePath, ref, commitSha, content string) {
+	t.Helper()
+	runCmd(t, clonePath, "git", "notes", "--ref", ref, "add", "-f", "-m", content, commitSha)
+	runCmd(t, clonePath, "git", "push", "-f", "origin", ref)
+}
+
 // TestMain checks for git availability before running tests.
 func TestMain(m *testing.M) {
 	if _, err := exec.LookPath("git"); err != nil {
@@ -194,7 +240,10 @@ func TestGitNoteOperations(t *testing.T) {
 		}
 
 		// Test with an empty namespace
-		emptyShas, err := NewNotesManager("empty-sha-test-namespace").GetNoteList()
+		if _, err := NewNotesManager("empty-sha-test-namespace").GetNoteList(); !IsNotesRefNotFound(err) {
+			t.Errorf("GetNoteList for empty namespace: expected NotesRefNotFoundError, got %v", err)
+		}
+		emptyShas, err := NewNotesManager("empty-sha-test-namespace", WithMissingRefAsEmpty()).GetNoteList()
 		if err != nil {
 			t.Fatalf("GetNoteList for empty namespace failed: %v", err)
 		}
@@ -275,11 +324,11 @@ func TestGitNoteOperations(t *testing.T) {
 		// }
 
 		// Test with an empty namespace (should also return empty slice, not nil)
-		emptyShas, err := NewNotesManager("empty-sha-test-namespace-sorted").GetNoteList()
+		emptyShas, err := NewNotesManager("empty-sha-test-namespace-sorted", WithMissingRefAsEmpty()).GetNoteList()
 		if err != nil {
 			t.Fatalf("GetNoteList for empty namespace failed: %v", err)
 		}
-		if len(emptyShas) != 0 {
+		if emptyShas == nil || len(emptyShas) != 0 {
 			t.Errorf("GetNoteList for empty namespace: expected 0 SHAs, got %d. List: %v", len(emptyShas), emptyShas)
 		}
 
@@ -632,7 +681,9 @@ func TestGitNoteRemoteOperations(t *testing.T) {
 			t.Fatal("Note still exists locally after delete, before FetchNotes test.")
 		}
 
-		if err := manager.FetchNotes("testorigin"); err != nil {
+		// The default merge mode would keep the local deletion, so force the remote notes back in.
+		forceManager := NewNotesManager(manager.GetRef(), WithFetchMode(FetchForce))
+		if err := forceManager.FetchNotes("testorigin"); err != nil {
 			t.Fatalf("FetchNotes failed: %v", err)
 		}
 
@@ -645,6 +696,49 @@ func TestGitNoteRemoteOperations(t *testing.T) {
 		}
 	})
 
+	t.Run("FetchNotesMergeKeepsUnpushedNotes", func(t *testing.T) {
+		mergeManager := NewNotesManager("remote-ops-namespace-fetch-merge")
+		localOnlySha := createTestCommit(t, localRepoPath, "fetchmerge.txt", "fetch merge", "Commit for fetch merge")
+		runCmd(t, localRepoPath, "git", "push", "testorigin", "main")
+
+		otherRepoPath := t.TempDir()
+		runCmd(t, "", "git", "clone", remoteRepoDir, otherRepoPath)
+		runCmd(t, otherRepoPath, "git", "config", "user.email", "test@example.com")
+		runCmd(t, otherRepoPath, "git", "config", "user.name", "Test User")
+		runCmd(t, otherRepoPath, "git", "notes", "--ref", mergeManager.GetRef(), "add", "-m", "remote note", localCommitSha)
+		runCmd(t, otherRepoPath, "git", "push", "origin", mergeManager.GetRef())
+
+		if err := mergeManager.SetNote(localOnlySha, "unpushed local note"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+
+		result, err := mergeManager.FetchNotesMerge("testorigin")
+		if err != nil {
+			t.Fatalf("FetchNotesMerge failed: %v", err)
+		}
+		if result == nil || result.Strategy != MergeCatSortUniq {
+			t.Fatalf("Expected a cat_sort_uniq merge result, got %+v", result)
+		}
+		if !reflect.DeepEqual(result.Added, []string{localCommitSha}) || len(result.Changed) != 0 || len(result.Removed) != 0 {
+			t.Errorf("Unexpected merge report: %+v", result)
+		}
+
+		if note, err := mergeManager.GetNote(localOnlySha); err != nil || note != "unpushed local note" {
+			t.Errorf("Unpushed local note lost after fetch: note=%q err=%v", note, err)
+		}
+		if note, err := mergeManager.GetNote(localCommitSha); err != nil || note != "remote note" {
+			t.Errorf("Remote note not merged after fetch: note=%q err=%v", note, err)
+		}
+
+		result, err = mergeManager.FetchNotesMerge("testorigin")
+		if err != nil {
+			t.Fatalf("Second FetchNotesMerge failed: %v", err)
+		}
+		if !result.UpToDate() {
+			t.Errorf("Expected second fetch to be up to date, got %+v", result)
+		}
+	})
+
 	t.Run("PushToNonExistentRemote_String", func(t *testing.T) {
 		if err := manager.SetNote(localCommitSha, "some note for non-existent remote"); err != nil {
 			t.Fatalf("SetNote locally failed: %v", err)
@@ -657,8 +751,8 @@ func TestGitNoteRemoteOperations(t *testing.T) {
 
 	t.Run("FetchFromNonExistentRemote_String", func(t *testing.T) {
 		err := manager.FetchNotes("nonexistentremote")
-		if err != nil {
-			t.Error("FetchNotes from non-existent remote should not have failed, but it did")
+		if !IsRemoteNotFound(err) {
+			t.Errorf("FetchNotes from non-existent remote should fail with RemoteNotFoundError, got %v", err)
 		}
 	})
 
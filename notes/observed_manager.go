@@ -0,0 +1,52 @@
+package notes
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// NewObservedNotesManager wraps manager so that observer is notified when each of its calls
+// starts and finishes. GetRef is not reported.
+func NewObservedNotesManager(manager NotesManager, observer Observer) NotesManager {
+	return &instrumentedNotesManager{NotesManager: manager, instrument: observeCalls(manager, observer)}
+}
+
+// NewTimedNotesManager creates a new notes manager with timing capabilities: the duration of
+// every call is logged with slog.Default().
+func NewTimedNotesManager(manager NotesManager) NotesManager {
+	return NewObservedNotesManager(manager, NewSlogObserver(nil))
+}
+
+// observeCalls returns the instrumenter reporting the start and end of the calls of manager to
+// observer. The calls run with a context counting their git commands.
+func observeCalls(manager NotesManager, observer Observer) callInstrumenter {
+	return func(ctx context.Context, call managerCall) (context.Context, func(any, error)) {
+		event := OperationEvent{
+			Operation: call.operation,
+			Namespace: manager.GetRef(),
+			Remote:    call.remote,
+			SHAs:      call.shas,
+			Start:     time.Now(),
+		}
+		var commands atomic.Int64
+		ctx = withGitCommandListener(ctx, nil, func(*GitCommand) func() {
+			commands.Add(1)
+			return nil
+		})
+		observer.OperationStarted(event)
+
+		return ctx, func(result any, err error) {
+			if shas, ok := result.([]string); ok {
+				event.SHAs = len(shas)
+			}
+			event.Duration = time.Since(event.Start)
+			event.Err = err
+			if err != nil {
+				event.ErrorCategory = categorize(err)
+			}
+			event.GitCommands = int(commands.Load())
+			observer.OperationFinished(event)
+		}
+	}
+}
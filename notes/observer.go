@@ -0,0 +1,80 @@
+package notes
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// OperationEvent describes a NotesManager call reported to an Observer.
+type OperationEvent struct {
+	// Operation is the NotesManager method, e.g. "GetNote" or "PushNotesTo".
+	Operation string
+	// Namespace is the notes ref of the manager.
+	Namespace string
+	// Remote is the remote of fetches and pushes ("" otherwise).
+	Remote string
+	// SHAs is the number of commits the call covers: the SHAs passed in, or those returned by
+	// GetNoteList.
+	SHAs  int
+	Start time.Time
+
+	// The fields below are set for OperationFinished only.
+	Duration time.Duration
+	Err      error
+	// ErrorCategory classifies Err ("" on success).
+	ErrorCategory BulkErrorCategory
+	// GitCommands is the number of git commands the call ran.
+	GitCommands int
+}
+
+// Observer is notified when the calls of a manager created by NewObservedNotesManager start and
+// finish. Calls may be reported concurrently.
+type Observer interface {
+	OperationStarted(event OperationEvent)
+	OperationFinished(event OperationEvent)
+}
+
+type slogObserver struct {
+	logger *slog.Logger
+}
+
+// NewSlogObserver returns an Observer that logs operation starts at debug level, successful
+// operations at info level and failed ones at warn level. A nil logger means slog.Default().
+func NewSlogObserver(logger *slog.Logger) Observer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogObserver{logger: logger}
+}
+
+func (o *slogObserver) OperationStarted(event OperationEvent) {
+	o.logger.LogAttrs(context.Background(), slog.LevelDebug, "notes operation started", o.attrs(event)...)
+}
+
+func (o *slogObserver) OperationFinished(event OperationEvent) {
+	attrs := append(o.attrs(event),
+		slog.Duration("duration", event.Duration),
+		slog.Int("git_commands", event.GitCommands),
+	)
+	if event.Err != nil {
+		attrs = append(attrs, slog.String("error_category", string(event.ErrorCategory)), slog.Any("error", event.Err))
+		o.logger.LogAttrs(context.Background(), slog.LevelWarn, "notes operation failed", attrs...)
+		return
+	}
+	o.logger.LogAttrs(context.Background(), slog.LevelInfo, "notes operation finished", attrs...)
+}
+
+func (o *slogObserver) attrs(event OperationEvent) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("operation", event.Operation),
+		slog.String("namespace", event.Namespace),
+	}
+	if event.Remote != "" {
+		attrs = append(attrs, slog.String("remote", event.Remote))
+	}
+	if event.SHAs > 0 {
+		attrs = append(attrs, slog.Int("shas", event.SHAs))
+	}
+	return attrs
+}
@@ -0,0 +1,122 @@
+package notes
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingObserver struct {
+	mu       sync.Mutex
+	started  []OperationEvent
+	finished []OperationEvent
+}
+
+func (o *recordingObserver) OperationStarted(event OperationEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, event)
+}
+
+func (o *recordingObserver) OperationFinished(event OperationEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, event)
+}
+
+func TestObservedNotesManager(t *testing.T) {
+	repoPath := setupTestRepo(t)
+	commitSha := createTestCommit(t, repoPath, "file.txt", "content", "Commit")
+	chdirForTest(t, repoPath)
+
+	t.Run("Events", func(t *testing.T) {
+		observer := &recordingObserver{}
+		manager := NewObservedNotesManager(NewNotesManager("observed"), observer)
+		if err := manager.SetNote(commitSha, "note"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		if _, err := manager.GetNoteList(); err != nil {
+			t.Fatalf("GetNoteList failed: %v", err)
+		}
+		if _, err := manager.GetNote("deadbeef"); !IsInvalidCommitSha(err) {
+			t.Fatalf("Expected InvalidCommitShaError, got %v", err)
+		}
+
+		if len(observer.started) != 3 || len(observer.finished) != 3 {
+			t.Fatalf("Expected 3 operations, got %d started and %d finished", len(observer.started), len(observer.finished))
+		}
+		set, list, get := observer.finished[0], observer.finished[1], observer.finished[2]
+		if set.Operation != "SetNote" || set.Namespace != "refs/notes/observed" || set.Err != nil || set.GitCommands == 0 || set.Duration <= 0 {
+			t.Errorf("Unexpected SetNote event: %+v", set)
+		}
+		if list.Operation != "GetNoteList" || list.SHAs != 1 {
+			t.Errorf("Unexpected GetNoteList event: %+v", list)
+		}
+		if get.Operation != "GetNote" || get.ErrorCategory != CategoryInvalid || !IsInvalidCommitSha(get.Err) {
+			t.Errorf("Unexpected GetNote event: %+v", get)
+		}
+	})
+
+	t.Run("ConcurrentGitCommands", func(t *testing.T) {
+		observer := &recordingObserver{}
+		get := NewObservedNotesManager(NewNotesManager("observed"), observer)
+		list := NewObservedNotesManager(NewNotesManager("observed"), observer)
+
+		// The other call runs all its commands while GetNote is in progress.
+		getStarted, listDone := make(chan struct{}), make(chan struct{})
+		var once sync.Once
+		restore := setGitCommandHooksForTesting(func(args []string) {
+			if args[0] == "notes" && slices.Contains(args, "show") {
+				once.Do(func() { close(getStarted) })
+				<-listDone
+			}
+		}, nil)
+		defer restore()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := get.GetNote(commitSha); err != nil {
+				t.Errorf("GetNote failed: %v", err)
+			}
+		}()
+		<-getStarted
+		if _, err := list.GetNoteList(); err != nil {
+			t.Fatalf("GetNoteList failed: %v", err)
+		}
+		close(listDone)
+		wg.Wait()
+
+		for _, event := range observer.finished {
+			if event.Operation == "GetNote" && event.GitCommands != 1 {
+				t.Errorf("Expected GetNote to run 1 git command, got %d", event.GitCommands)
+			}
+		}
+	})
+
+	t.Run("Slog", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		manager := NewObservedNotesManager(NewNotesManager("observed"), NewSlogObserver(logger))
+		if _, err := manager.GetNote(commitSha); err != nil {
+			t.Fatalf("GetNote failed: %v", err)
+		}
+		manager.PushNotes("nonexistentremote")
+
+		out := buf.String()
+		for _, want := range []string{
+			`level=DEBUG msg="notes operation started" operation=GetNote namespace=refs/notes/observed shas=1`,
+			`level=INFO msg="notes operation finished" operation=GetNote`,
+			`level=WARN msg="notes operation failed" operation=PushNotes namespace=refs/notes/observed remote=nonexistentremote`,
+			"error_category=remote",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("Expected %q in log output:\n%s", want, out)
+			}
+		}
+	})
+}
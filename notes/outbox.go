@@ -0,0 +1,260 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// outboxFileName is the file, inside the git common directory, holding pending pushes.
+	outboxFileName = "notes-outbox.json"
+	// DefaultOutboxRetryInterval is how long a manager waits between automatic flush attempts.
+	DefaultOutboxRetryInterval = 30 * time.Second
+)
+
+// outboxMu serializes outbox file updates within this process.
+var outboxMu sync.Mutex
+
+// PendingPush is a push that failed with a NetworkError and is waiting to be replayed.
+// Only the remote's name or URL is stored; the environment, configuration overrides and timeout of
+// a Remote are kept in memory by the manager that queued the push and are not persisted.
+type PendingPush struct {
+	Ref string `json:"ref"`
+	// Remote is the remote name or URL.
+	Remote      string    `json:"remote"`
+	QueuedAt    time.Time `json:"queued_at"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// WithOutbox makes pushes that fail because the remote is unreachable durable: the push is recorded
+// in an outbox file under the repository's .git directory and replayed by FlushPending or, at most
+// once per retryInterval, at the start of the manager's next write, fetch or push.
+// A retryInterval of zero means DefaultOutboxRetryInterval.
+func WithOutbox(retryInterval time.Duration) Option {
+	return func(m *notesManager) {
+		if retryInterval <= 0 {
+			retryInterval = DefaultOutboxRetryInterval
+		}
+		m.outbox = &outboxState{retryInterval: retryInterval}
+	}
+}
+
+// outboxState tracks automatic flush attempts of a manager.
+type outboxState struct {
+	retryInterval time.Duration
+
+	mu        sync.Mutex
+	lastFlush time.Time
+	// remotes holds the descriptors of the remotes pushed to, keyed by name or URL.
+	remotes map[string]Remote
+}
+
+// remote returns the descriptor last used for target, or the remote target resolves to.
+func (o *outboxState) remote(ctx context.Context, target string) Remote {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if remote, ok := o.remotes[target]; ok {
+		return remote
+	}
+	return resolveRemote(ctx, target)
+}
+
+func (o *outboxState) remember(remote Remote) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.remotes == nil {
+		o.remotes = make(map[string]Remote)
+	}
+	o.remotes[remote.target()] = remote
+}
+
+// PendingPushes returns the pushes of this manager's notes ref waiting in the outbox.
+func (m *notesManager) PendingPushes() ([]PendingPush, error) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	entries, err := readOutbox(m.gitContext())
+	if err != nil {
+		return nil, err
+	}
+	var pending []PendingPush
+	for _, entry := range entries {
+		if entry.Ref == m.ref {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, nil
+}
+
+// FlushPending replays every pending push of this manager's notes ref. Pushes that succeed are
+// removed from the outbox; the errors of those that fail again are joined and returned.
+func (m *notesManager) FlushPending() error {
+	if m.outbox != nil {
+		m.outbox.mu.Lock()
+		m.outbox.lastFlush = time.Now()
+		m.outbox.mu.Unlock()
+	}
+	return m.flushPending("")
+}
+
+// flushPending replays the pending pushes of this manager's notes ref, except those to skipRemote.
+func (m *notesManager) flushPending(skipRemote string) error {
+	pending, err := m.PendingPushes()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range pending {
+		if entry.Remote == skipRemote {
+			continue
+		}
+		remote := resolveRemote(m.gitContext(), entry.Remote)
+		if m.outbox != nil {
+			remote = m.outbox.remote(m.gitContext(), entry.Remote)
+		}
+		_, err := m.pushNotesWithRetry(remote, m.retryPolicy.MaxAttempts)
+		if outboxErr := m.recordPushOutcome(remote, err); outboxErr != nil {
+			errs = append(errs, outboxErr)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pending push of %s to %s failed: %w", m.ref, remote, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// maybeFlushPending replays pending pushes if the outbox is enabled and the retry interval has
+// passed since the last attempt. Failures are kept in the outbox and otherwise ignored.
+func (m *notesManager) maybeFlushPending(skipRemote string) {
+	if m.outbox == nil || m.dryRun {
+		return
+	}
+	m.outbox.mu.Lock()
+	due := time.Since(m.outbox.lastFlush) >= m.outbox.retryInterval
+	if due {
+		m.outbox.lastFlush = time.Now()
+	}
+	m.outbox.mu.Unlock()
+
+	if due {
+		_ = m.flushPending(skipRemote)
+	}
+}
+
+// recordPushOutcome updates the outbox after a push to remote: a success removes the pending
+// entry, a failure with a NetworkError adds or updates it. Other failures, e.g. authentication
+// failures or missing repositories, leave the outbox unchanged. The repository lock is held while
+// the outbox is rewritten, so managers in other processes do not lose each other's entries.
+func (m *notesManager) recordPushOutcome(remote Remote, pushErr error) error {
+	if m.outbox == nil || m.dryRun {
+		return nil
+	}
+	if pushErr != nil && !IsNetworkError(pushErr) {
+		return nil
+	}
+	m.outbox.remember(remote)
+	remoteName := remote.target()
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	return m.withRepoLock(func() error {
+		entries, err := readOutbox(m.gitContext())
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		updated := entries[:0]
+		found := false
+		for _, entry := range entries {
+			if entry.Ref == m.ref && entry.Remote == remoteName {
+				if pushErr == nil {
+					continue
+				}
+				found = true
+				entry.Attempts++
+				entry.LastAttempt = now
+				entry.LastError = pushErr.Error()
+			}
+			updated = append(updated, entry)
+		}
+		if pushErr != nil && !found {
+			updated = append(updated, PendingPush{
+				Ref:         m.ref,
+				Remote:      remoteName,
+				QueuedAt:    now,
+				Attempts:    1,
+				LastAttempt: now,
+				LastError:   pushErr.Error(),
+			})
+		}
+		return writeOutbox(m.gitContext(), updated)
+	})
+}
+
+// outboxPath returns the location of the outbox file of the current repository.
+func outboxPath(ctx context.Context) (string, error) {
+	commonDir, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory (stderr: %s): %w", stderr, err)
+	}
+	return filepath.Join(commonDir, outboxFileName), nil
+}
+
+func readOutbox(ctx context.Context) ([]PendingPush, error) {
+	path, err := outboxPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes outbox %s: %w", path, err)
+	}
+
+	var entries []PendingPush
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse notes outbox %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// writeOutbox replaces the outbox file atomically, removing it when entries is empty.
+func writeOutbox(ctx context.Context, entries []PendingPush) error {
+	path, err := outboxPath(ctx)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove notes outbox %s: %w", path, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode notes outbox: %w", err)
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write notes outbox %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace notes outbox %s: %w", path, err)
+	}
+	return nil
+}
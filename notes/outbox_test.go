@@ -0,0 +1,118 @@
+package notes
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	localPath, remotePath, _, commitSha := setupRemoteTestRepos(t)
+	manager := NewNotesManager("outbox", WithOutbox(time.Hour))
+	if err := manager.SetNote(commitSha, "queued note"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+
+	// Nothing listens on port 1, so the remote is unreachable while it points there.
+	goOffline := func(t *testing.T) {
+		t.Helper()
+		runCmd(t, localPath, "git", "remote", "set-url", "testorigin", "http://127.0.0.1:1/offline.git")
+	}
+	goOnline := func(t *testing.T) {
+		t.Helper()
+		runCmd(t, localPath, "git", "remote", "set-url", "testorigin", remotePath)
+	}
+
+	goOffline(t)
+	err := manager.PushNotes("testorigin")
+	if !IsPushQueued(err) {
+		t.Fatalf("Expected PushQueuedError, got %v", err)
+	}
+	if queued := err.(*PushQueuedError); queued.Pending != 1 || queued.Remote != "testorigin" {
+		t.Errorf("Unexpected queued error: %+v", queued)
+	}
+
+	// A second failure updates the entry instead of adding one, and the outbox survives the manager.
+	_ = manager.PushNotes("testorigin")
+	pending, err := NewNotesManager("outbox", WithOutbox(0)).PendingPushes()
+	if err != nil {
+		t.Fatalf("PendingPushes failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Ref != manager.GetRef() || pending[0].Attempts != 2 || pending[0].LastError == "" {
+		t.Fatalf("Unexpected pending pushes: %+v", pending)
+	}
+	if other, _ := NewNotesManager("other").PendingPushes(); len(other) != 0 {
+		t.Errorf("Expected no pending pushes for another namespace, got %+v", other)
+	}
+
+	t.Run("FlushPendingWhileOfflineKeepsEntry", func(t *testing.T) {
+		if err := manager.FlushPending(); err == nil {
+			t.Fatal("Expected FlushPending to fail while the remote is offline")
+		}
+		if pending, _ := manager.PendingPushes(); len(pending) != 1 {
+			t.Errorf("Expected the push to stay queued, got %+v", pending)
+		}
+	})
+
+	goOnline(t)
+
+	t.Run("FlushPending", func(t *testing.T) {
+		if err := manager.FlushPending(); err != nil {
+			t.Fatalf("FlushPending failed: %v", err)
+		}
+		if pending, _ := manager.PendingPushes(); len(pending) != 0 {
+			t.Errorf("Expected an empty outbox, got %+v", pending)
+		}
+		lsRemote, _ := runCmd(t, localPath, "git", "ls-remote", "testorigin", manager.GetRef())
+		if !strings.HasPrefix(lsRemote, refTip(context.Background(), manager.GetRef())) {
+			t.Errorf("Expected the remote to have the local notes tip, got %q", lsRemote)
+		}
+	})
+
+	t.Run("ReplayOnNextOperation", func(t *testing.T) {
+		goOffline(t)
+		replaying := NewNotesManager("outbox", WithOutbox(time.Nanosecond))
+		if err := replaying.SetNote(commitSha, "second note"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		if err := replaying.PushNotes("testorigin"); !IsPushQueued(err) {
+			t.Fatalf("Expected PushQueuedError, got %v", err)
+		}
+		goOnline(t)
+
+		if _, err := replaying.GetNoteList(); err != nil {
+			t.Fatalf("GetNoteList failed: %v", err)
+		}
+		if pending, _ := replaying.PendingPushes(); len(pending) != 1 {
+			t.Fatalf("Expected reads not to replay pending pushes, got %+v", pending)
+		}
+		if err := replaying.DeleteNote(commitSha); err != nil {
+			t.Fatalf("DeleteNote failed: %v", err)
+		}
+		if pending, _ := replaying.PendingPushes(); len(pending) != 0 {
+			t.Errorf("Expected the next write to replay the pending push, got %+v", pending)
+		}
+		lsRemote, _ := runCmd(t, localPath, "git", "ls-remote", "testorigin", replaying.GetRef())
+		if lsRemote == "" {
+			t.Error("Expected the replayed push to reach the remote")
+		}
+	})
+
+	t.Run("MissingRepositoryIsNotQueued", func(t *testing.T) {
+		missingPath := remotePath + ".missing"
+		if err := os.Rename(remotePath, missingPath); err != nil {
+			t.Fatalf("Failed to move the remote: %v", err)
+		}
+		defer os.Rename(missingPath, remotePath)
+
+		err := manager.PushNotes("testorigin")
+		if err == nil || IsPushQueued(err) || !IsRemoteNotFound(err) {
+			t.Fatalf("Expected an unqueued RemoteNotFoundError, got %v", err)
+		}
+		if pending, _ := manager.PendingPushes(); len(pending) != 0 {
+			t.Errorf("Expected a missing repository not to be queued, got %+v", pending)
+		}
+	})
+}
@@ -0,0 +1,379 @@
+package notes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateIssueKind classifies a problem found by CheckState.
+type StateIssueKind string
+
+const (
+	// IssuePartialMerge is a `git notes merge` that was started but neither committed nor aborted.
+	IssuePartialMerge StateIssueKind = "partial_merge"
+	// IssueOrphanedRef is a remote-tracking notes ref of a remote that is no longer configured, a
+	// scratch ref left behind by an interrupted dry run or, with RecoveryOptions.PruneURLTrackingRefs,
+	// a remote-tracking notes ref of a remote given by URL.
+	IssueOrphanedRef StateIssueKind = "orphaned_ref"
+	// IssueDanglingLock is a stale manager lock or a stale git lock file of a notes ref.
+	IssueDanglingLock StateIssueKind = "dangling_lock"
+)
+
+// StateIssue describes a leftover of an interrupted operation.
+type StateIssue struct {
+	Kind StateIssueKind
+	// Ref is the notes ref being merged into (partial merge), the orphaned ref, or the ref guarded
+	// by a git lock file ("" for the manager lock).
+	Ref string
+	// Path is the lock file (dangling lock) or the merge worktree (partial merge).
+	Path string
+	// PartialCommit is the merge commit prepared by git and Conflicts the annotated objects whose
+	// notes still have to be resolved (partial merge only).
+	PartialCommit string
+	Conflicts     []string
+	// Owner is the recorded holder of a stale manager lock.
+	Owner *LockOwner
+	// Age is how long ago a dangling lock was taken.
+	Age time.Duration
+}
+
+func (i StateIssue) String() string {
+	switch i.Kind {
+	case IssuePartialMerge:
+		return fmt.Sprintf("%s: merge into %s (partial commit %s, %d unresolved)", i.Kind, i.Ref, i.PartialCommit, len(i.Conflicts))
+	case IssueDanglingLock:
+		return fmt.Sprintf("%s: %s (age %v)", i.Kind, i.Path, i.Age.Round(time.Second))
+	default:
+		return fmt.Sprintf("%s: %s", i.Kind, i.Ref)
+	}
+}
+
+// StateReport lists the issues found in the repository.
+type StateReport struct {
+	Issues []StateIssue
+}
+
+// Healthy reports whether no issues were found.
+func (r *StateReport) Healthy() bool {
+	return len(r.Issues) == 0
+}
+
+// MergeRepair selects how RecoverState resolves a partial merge.
+type MergeRepair int
+
+const (
+	// MergeRepairNone leaves a partial merge untouched.
+	MergeRepairNone MergeRepair = iota
+	// MergeRepairAbort discards the partial merge; the notes ref keeps its pre-merge value.
+	MergeRepairAbort
+	// MergeRepairCommit commits the partial merge with the current content of the merge worktree.
+	MergeRepairCommit
+	// MergeRepairResetToReflog discards the partial merge and resets the notes ref to the reflog
+	// entry RecoveryOptions.ReflogEntry.
+	MergeRepairResetToReflog
+)
+
+// RecoveryOptions selects the repairs made by RecoverState.
+type RecoveryOptions struct {
+	Merge MergeRepair
+	// ReflogEntry is n in <ref>@{n} for MergeRepairResetToReflog. Zero means 1.
+	ReflogEntry int
+	// PruneOrphanedRefs deletes orphaned refs.
+	PruneOrphanedRefs bool
+	// PruneURLTrackingRefs reports the remote-tracking notes refs of remotes given by URL (under
+	// refs/url-remotes/) as orphaned and deletes them. CheckState never reports these refs, as
+	// they do not belong to a configured remote.
+	PruneURLTrackingRefs bool
+	// RemoveDanglingLocks deletes stale lock files.
+	RemoveDanglingLocks bool
+	// Lock configures the lock taken while repairing and the age after which locks count as
+	// stale. The zero value means DefaultLockConfig.
+	Lock LockConfig
+	// Hooks are called around every git command RecoverState runs.
+	Hooks CommandHooks
+}
+
+// RecoveryResult reports the issues found by RecoverState and those it repaired.
+type RecoveryResult struct {
+	Found    []StateIssue
+	Repaired []StateIssue
+}
+
+// CheckState inspects the current repository for leftovers of interrupted notes operations
+// without changing anything.
+func CheckState() (*StateReport, error) {
+	return checkState(context.Background(), DefaultLockConfig())
+}
+
+// RecoverState checks the repository like CheckState and applies the repairs selected by opts.
+// Dangling locks are removed first; the other repairs are made while holding the repository lock.
+func RecoverState(opts RecoveryOptions) (*RecoveryResult, error) {
+	if opts.Lock == (LockConfig{}) {
+		opts.Lock = DefaultLockConfig()
+	}
+	ctx := hooksContext("", opts.Hooks)
+	report, err := checkState(ctx, opts.Lock)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PruneURLTrackingRefs {
+		urlRefs, err := findURLTrackingRefs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.Issues = append(report.Issues, urlRefs...)
+	}
+	result := &RecoveryResult{Found: report.Issues}
+
+	var rest []StateIssue
+	for _, issue := range report.Issues {
+		if issue.Kind != IssueDanglingLock {
+			rest = append(rest, issue)
+			continue
+		}
+		if opts.RemoveDanglingLocks {
+			if err := os.Remove(issue.Path); err != nil && !os.IsNotExist(err) {
+				return result, fmt.Errorf("failed to remove lock file %s: %w", issue.Path, err)
+			}
+			result.Repaired = append(result.Repaired, issue)
+		}
+	}
+
+	release, err := acquireRepoLock(ctx, opts.Lock)
+	if err != nil {
+		return result, err
+	}
+	defer release()
+
+	for _, issue := range rest {
+		var repaired bool
+		switch issue.Kind {
+		case IssuePartialMerge:
+			repaired, err = repairPartialMerge(ctx, issue, opts)
+		case IssueOrphanedRef:
+			if opts.PruneOrphanedRefs || opts.PruneURLTrackingRefs && strings.HasPrefix(issue.Ref, urlTrackingRefPrefix) {
+				if _, stderr, err := executeGitCommandContext(ctx, "update-ref", "-d", issue.Ref); err != nil {
+					return result, fmt.Errorf("failed to delete orphaned ref %s (stderr: %s): %w", issue.Ref, stderr, err)
+				}
+				repaired = true
+			}
+		}
+		if err != nil {
+			return result, err
+		}
+		if repaired {
+			result.Repaired = append(result.Repaired, issue)
+		}
+	}
+	return result, nil
+}
+
+func repairPartialMerge(ctx context.Context, issue StateIssue, opts RecoveryOptions) (bool, error) {
+	switch opts.Merge {
+	case MergeRepairAbort, MergeRepairResetToReflog:
+		if _, stderr, err := executeGitCommandContext(ctx, "notes", "--ref", issue.Ref, "merge", "--abort"); err != nil {
+			return false, fmt.Errorf("failed to abort notes merge into %s (stderr: %s): %w", issue.Ref, stderr, err)
+		}
+		if opts.Merge == MergeRepairAbort {
+			return true, nil
+		}
+		entry := opts.ReflogEntry
+		if entry <= 0 {
+			entry = 1
+		}
+		target, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--verify", fmt.Sprintf("%s@{%d}", issue.Ref, entry))
+		if err != nil {
+			return false, fmt.Errorf("failed to resolve reflog entry %d of %s (stderr: %s): %w", entry, issue.Ref, stderr, err)
+		}
+		if _, stderr, err := executeGitCommandContext(ctx, "update-ref", "-m", "notes: reset by RecoverState", issue.Ref, target); err != nil {
+			return false, fmt.Errorf("failed to reset %s to %s (stderr: %s): %w", issue.Ref, target, stderr, err)
+		}
+		return true, nil
+	case MergeRepairCommit:
+		if _, stderr, err := executeGitCommandContext(ctx, "notes", "--ref", issue.Ref, "merge", "--commit"); err != nil {
+			return false, fmt.Errorf("failed to commit notes merge into %s (stderr: %s): %w", issue.Ref, stderr, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func checkState(ctx context.Context, lockConfig LockConfig) (*StateReport, error) {
+	if lockConfig.StaleAfter <= 0 {
+		lockConfig.StaleAfter = DefaultLockStaleAfter
+	}
+	report := &StateReport{}
+
+	merge, err := findPartialMerge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if merge != nil {
+		report.Issues = append(report.Issues, *merge)
+	}
+
+	orphaned, err := findOrphanedRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Issues = append(report.Issues, orphaned...)
+
+	locks, err := findDanglingLocks(ctx, lockConfig.StaleAfter)
+	if err != nil {
+		return nil, err
+	}
+	report.Issues = append(report.Issues, locks...)
+	return report, nil
+}
+
+// findPartialMerge reports the state left by an unfinished `git notes merge`, if any.
+func findPartialMerge(ctx context.Context) (*StateIssue, error) {
+	inProgress, err := notesMergeInProgress(ctx)
+	if err != nil || !inProgress {
+		return nil, err
+	}
+
+	issue := &StateIssue{Kind: IssuePartialMerge}
+	if path, _, err := executeGitCommandContext(ctx, "rev-parse", "--git-path", "NOTES_MERGE_REF"); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			issue.Ref = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "ref:"))
+		}
+	}
+	if path, _, err := executeGitCommandContext(ctx, "rev-parse", "--git-path", "NOTES_MERGE_PARTIAL"); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			issue.PartialCommit = strings.TrimSpace(string(data))
+		}
+	}
+	if worktree, conflicts, err := notesMergeWorktree(ctx); err == nil {
+		issue.Path, issue.Conflicts = worktree, conflicts
+	}
+	return issue, nil
+}
+
+// findOrphanedRefs lists remote-tracking notes refs of remotes that are no longer configured and
+// scratch refs of interrupted dry runs. Remote-tracking notes refs are those under
+// refs/remotes/<remote>/notes/ and refs/notes/remotes/<remote>/; other refs that merely contain
+// "/notes/", e.g. branches named release/notes/..., are left alone.
+// Refs under refs/url-remotes/ are kept: remotes given by URL are never configured, so there is
+// no configuration to tell whether they are still in use (see RecoveryOptions.PruneURLTrackingRefs).
+func findOrphanedRefs(ctx context.Context) ([]StateIssue, error) {
+	remotesOutput, stderr, err := executeGitCommandContext(ctx, "remote")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes (stderr: %s): %w", stderr, err)
+	}
+	configured := make(map[string]bool)
+	for _, remote := range strings.Fields(remotesOutput) {
+		configured[remote] = true
+	}
+
+	refsOutput, stderr, err := executeGitCommandContext(ctx, "for-each-ref", "--format=%(refname)",
+		"refs/remotes/", legacyTrackingRefPrefix, scratchRefPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs (stderr: %s): %w", stderr, err)
+	}
+
+	var issues []StateIssue
+	scanner := bufio.NewScanner(strings.NewReader(refsOutput))
+	for scanner.Scan() {
+		ref := scanner.Text()
+		if strings.HasPrefix(ref, scratchRefPrefix) {
+			issues = append(issues, StateIssue{Kind: IssueOrphanedRef, Ref: ref})
+			continue
+		}
+		if remote, ok := notesTrackingRemote(ref, configured); ok && !configured[remote] {
+			issues = append(issues, StateIssue{Kind: IssueOrphanedRef, Ref: ref})
+		}
+	}
+	return issues, scanner.Err()
+}
+
+// findURLTrackingRefs lists the remote-tracking notes refs of remotes given by URL.
+func findURLTrackingRefs(ctx context.Context) ([]StateIssue, error) {
+	refsOutput, stderr, err := executeGitCommandContext(ctx, "for-each-ref", "--format=%(refname)", urlTrackingRefPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs (stderr: %s): %w", stderr, err)
+	}
+	var issues []StateIssue
+	for _, ref := range strings.Fields(refsOutput) {
+		issues = append(issues, StateIssue{Kind: IssueOrphanedRef, Ref: ref})
+	}
+	return issues, nil
+}
+
+// notesTrackingRemote returns the remote a remote-tracking notes ref belongs to, or false if ref is
+// not one. Configured remote names may contain slashes; other remotes are assumed not to.
+func notesTrackingRemote(ref string, configured map[string]bool) (string, bool) {
+	if rest, ok := strings.CutPrefix(ref, "refs/remotes/"); ok {
+		for remote := range configured {
+			if strings.HasPrefix(rest, remote+"/notes/") {
+				return remote, true
+			}
+		}
+		remote, path, _ := strings.Cut(rest, "/")
+		return remote, strings.HasPrefix(path, "notes/")
+	}
+	if rest, ok := strings.CutPrefix(ref, legacyTrackingRefPrefix); ok {
+		for remote := range configured {
+			if strings.HasPrefix(rest, remote+"/") {
+				return remote, true
+			}
+		}
+		remote, _, found := strings.Cut(rest, "/")
+		return remote, found
+	}
+	return "", false
+}
+
+// findDanglingLocks lists the manager lock if it is stale and git lock files of notes refs older
+// than staleAfter.
+func findDanglingLocks(ctx context.Context, staleAfter time.Duration) ([]StateIssue, error) {
+	commonDir, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git directory (stderr: %s): %w", stderr, err)
+	}
+
+	var issues []StateIssue
+	managerLock := filepath.Join(commonDir, lockFileName)
+	if _, err := os.Stat(managerLock); err == nil {
+		hostname, _ := os.Hostname()
+		owner, _, stale := inspectLock(managerLock, hostname, staleAfter)
+		if stale {
+			issues = append(issues, StateIssue{Kind: IssueDanglingLock, Path: managerLock, Owner: &owner, Age: time.Since(owner.Acquired)})
+		}
+	}
+
+	notesDir := filepath.Join(commonDir, "refs", "notes")
+	var refLocks []StateIssue
+	err = filepath.WalkDir(notesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if age := time.Since(info.ModTime()); age > staleAfter {
+			rel, _ := filepath.Rel(commonDir, strings.TrimSuffix(path, ".lock"))
+			refLocks = append(refLocks, StateIssue{Kind: IssueDanglingLock, Ref: filepath.ToSlash(rel), Path: path, Age: age})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s for lock files: %w", notesDir, err)
+	}
+	sort.Slice(refLocks, func(i, j int) bool { return refLocks[i].Path < refLocks[j].Path })
+	return append(issues, refLocks...), nil
+}
@@ -0,0 +1,153 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoverState(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	ref := formatNamespaceRef("recover")
+	trackingRef := "refs/remotes/testorigin/notes/recover"
+
+	// startPartialMerge leaves a conflicting manual merge behind, as a crashed process would.
+	startPartialMerge := func(t *testing.T) string {
+		t.Helper()
+		runCmd(t, localPath, "git", "notes", "--ref", ref, "add", "-f", "-m", "local", commitSha)
+		runCmd(t, localPath, "git", "fetch", "testorigin", "+"+ref+":"+trackingRef)
+		tip := refTip(context.Background(), ref)
+		_, _, _ = executeGitCommand("notes", "--ref", ref, "merge", "-s", "manual", trackingRef)
+		if inProgress, _ := notesMergeInProgress(context.Background()); !inProgress {
+			t.Fatal("Expected the manual merge to stop with a conflict")
+		}
+		return tip
+	}
+	pushNoteFromClone(t, clonePath, ref, commitSha, "remote")
+
+	t.Run("CheckStateReportsIssues", func(t *testing.T) {
+		if report, err := CheckState(); err != nil || !report.Healthy() {
+			t.Fatalf("Expected a healthy repository, got %+v (%v)", report, err)
+		}
+
+		startPartialMerge(t)
+		runCmd(t, localPath, "git", "update-ref", "refs/remotes/gone/notes/recover", commitSha)
+		runCmd(t, localPath, "git", "update-ref", "refs/notes/dry-run-scratch/1-1", refTip(context.Background(), ref))
+		runCmd(t, localPath, "git", "update-ref", "refs/notes/remotes/gone/recover", refTip(context.Background(), ref))
+		// Branches whose names merely contain "notes" are not remote-tracking notes refs.
+		for _, branch := range []string{"refs/remotes/origin/docs/notes/x", "refs/remotes/gone/docs/notes/x", "refs/heads/release/notes/1.0"} {
+			runCmd(t, localPath, "git", "update-ref", branch, commitSha)
+			defer runCmd(t, localPath, "git", "update-ref", "-d", branch)
+		}
+
+		lockFile := filepath.Join(localPath, ".git", lockFileName)
+		data, _ := json.Marshal(LockOwner{PID: os.Getpid(), Hostname: "elsewhere", Acquired: time.Now().Add(-time.Hour)})
+		if err := os.WriteFile(lockFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(lockFile, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+		refLock := filepath.Join(localPath, ".git", "refs", "notes", "recover.lock")
+		if err := os.WriteFile(refLock, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour)
+		_ = os.Chtimes(refLock, old, old)
+
+		report, err := CheckState()
+		if err != nil {
+			t.Fatalf("CheckState failed: %v", err)
+		}
+		kinds := make(map[StateIssueKind][]StateIssue)
+		for _, issue := range report.Issues {
+			kinds[issue.Kind] = append(kinds[issue.Kind], issue)
+		}
+		merges := kinds[IssuePartialMerge]
+		if len(merges) != 1 || merges[0].Ref != ref || merges[0].PartialCommit == "" || !reflect.DeepEqual(merges[0].Conflicts, []string{commitSha}) {
+			t.Errorf("Unexpected partial merge issues: %+v", merges)
+		}
+		if orphaned := kinds[IssueOrphanedRef]; len(orphaned) != 3 {
+			t.Errorf("Expected the orphaned tracking refs and scratch ref, got %+v", orphaned)
+		}
+		if locks := kinds[IssueDanglingLock]; len(locks) != 2 || locks[0].Owner == nil || locks[1].Ref != ref {
+			t.Errorf("Expected the stale manager lock and ref lock, got %+v", locks)
+		}
+
+		result, err := RecoverState(RecoveryOptions{Merge: MergeRepairAbort, PruneOrphanedRefs: true, RemoveDanglingLocks: true})
+		if err != nil {
+			t.Fatalf("RecoverState failed: %v", err)
+		}
+		if len(result.Found) != 6 || len(result.Repaired) != 6 {
+			t.Errorf("Expected all 6 issues to be repaired, got %+v", result)
+		}
+		if report, _ := CheckState(); !report.Healthy() {
+			t.Errorf("Expected a healthy repository after recovery, got %+v", report.Issues)
+		}
+	})
+
+	t.Run("PruneURLTrackingRefs", func(t *testing.T) {
+		urlRef, err := buildRemoteTrackingRef(RemoteURL("https://example.com/backup.git"), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runCmd(t, localPath, "git", "update-ref", urlRef, refTip(context.Background(), ref))
+
+		// URL tracking refs are kept unless pruning them is requested.
+		if report, err := CheckState(); err != nil || !report.Healthy() {
+			t.Fatalf("Expected URL tracking refs to be kept, got %+v (%v)", report, err)
+		}
+		result, err := RecoverState(RecoveryOptions{PruneOrphanedRefs: true})
+		if err != nil || len(result.Found) != 0 {
+			t.Fatalf("Expected no issues without PruneURLTrackingRefs, got %+v (%v)", result, err)
+		}
+
+		result, err = RecoverState(RecoveryOptions{PruneURLTrackingRefs: true})
+		if err != nil {
+			t.Fatalf("RecoverState failed: %v", err)
+		}
+		expected := []StateIssue{{Kind: IssueOrphanedRef, Ref: urlRef}}
+		if !reflect.DeepEqual(result.Found, expected) || !reflect.DeepEqual(result.Repaired, expected) {
+			t.Errorf("Expected %s to be found and pruned, got %+v", urlRef, result)
+		}
+		if tip := refTip(context.Background(), urlRef); tip != "" {
+			t.Errorf("Expected %s to be deleted, still at %s", urlRef, tip)
+		}
+	})
+
+	t.Run("CommitPartialMerge", func(t *testing.T) {
+		before := startPartialMerge(t)
+		worktree, _ := runCmd(t, localPath, "git", "rev-parse", "--git-path", "NOTES_MERGE_WORKTREE")
+		if err := os.WriteFile(filepath.Join(localPath, worktree, commitSha), []byte("resolved\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RecoverState(RecoveryOptions{Merge: MergeRepairCommit}); err != nil {
+			t.Fatalf("RecoverState failed: %v", err)
+		}
+		parents, _ := runCmd(t, localPath, "git", "rev-list", "--parents", "-n", "1", ref)
+		if len(strings.Fields(parents)) != 3 || !strings.Contains(parents, before) {
+			t.Errorf("Expected a merge commit on top of %s, got %s", before, parents)
+		}
+		if note, _ := NewNotesManager("recover").GetNote(commitSha); note != "resolved" {
+			t.Errorf("Expected the resolved note, got %q", note)
+		}
+	})
+
+	t.Run("ResetToReflog", func(t *testing.T) {
+		pushNoteFromClone(t, clonePath, ref, commitSha, "remote again")
+		previous := refTip(context.Background(), ref)
+		startPartialMerge(t)
+		if _, err := RecoverState(RecoveryOptions{Merge: MergeRepairResetToReflog}); err != nil {
+			t.Fatalf("RecoverState failed: %v", err)
+		}
+		if tip := refTip(context.Background(), ref); tip != previous {
+			t.Errorf("Expected %s to be reset to %s, got %s", ref, previous, tip)
+		}
+		if inProgress, _ := notesMergeInProgress(context.Background()); inProgress {
+			t.Error("Expected the partial merge to be discarded")
+		}
+	})
+}
@@ -34,6 +34,21 @@ var (
 	rejectedPattern       = regexp.MustCompile(`(?i)rejected`)
 	conflictPattern       = regexp.MustCompile(`(?i)conflict`)
 
+	// Concurrent ref update patterns (case-insensitive)
+	cannotLockRefPattern = regexp.MustCompile(`(?i)cannot lock ref|unable to create '.*\.lock'`)
+
+	// Transient network failure patterns (case-insensitive)
+	transientNetworkPattern = regexp.MustCompile(`(?i)connection (reset|refused|timed out)|operation timed out|could not resolve host|temporary failure in name resolution|the remote end hung up unexpectedly|early eof|rpc failed|context deadline exceeded`)
+
+	// Unreachable remote patterns (case-insensitive)
+	remoteUnreachablePattern = regexp.MustCompile(`(?i)could not read from remote repository|unable to access|failed to connect|couldn't connect`)
+
+	// Missing remote repository patterns (case-insensitive)
+	remoteNotFoundPattern = regexp.MustCompile(`(?i)does not appear to be a git repository|repository '.*' not found|repository not found|no such remote`)
+
+	// Authentication failure patterns (case-insensitive)
+	authenticationPattern = regexp.MustCompile(`(?i)authentication failed|permission denied|could not read (username|password)|terminal prompts disabled|invalid username or password|host key verification failed|the requested url returned error: 40[13]`)
+
 	// Merge status patterns (case-insensitive)
 	alreadyUpToDatePattern = regexp.MustCompile(`(?i)already up to date`)
 	nothingToMergePattern  = regexp.MustCompile(`(?i)nothing to merge`)
@@ -43,7 +58,9 @@ var (
 	hexCharPattern    = regexp.MustCompile(`^[0-9a-fA-F]+$`)
 )
 
-// ErrorMatcher provides optimized error pattern matching
+// ErrorMatcher provides optimized error pattern matching.
+// It matches git's English messages, which the manager gets by running git in the "C" locale.
+// Where git offers one, the manager relies on an exit code or plumbing output instead.
 type ErrorMatcher struct{}
 
 // NewErrorMatcher creates a new error matcher instance
@@ -95,6 +112,31 @@ func (em *ErrorMatcher) IsPushRetryableError(errStr string) bool {
 		rejectedPattern.MatchString(errStr)
 }
 
+// IsRefLockError checks if a ref update failed because the ref was locked or moved concurrently
+func (em *ErrorMatcher) IsRefLockError(errStr string) bool {
+	return cannotLockRefPattern.MatchString(errStr)
+}
+
+// IsTransientNetworkError checks if a remote operation failed due to a network problem that may go away
+func (em *ErrorMatcher) IsTransientNetworkError(errStr string) bool {
+	return transientNetworkPattern.MatchString(errStr)
+}
+
+// IsRemoteUnreachableError checks if a remote operation failed because the remote could not be reached
+func (em *ErrorMatcher) IsRemoteUnreachableError(errStr string) bool {
+	return remoteUnreachablePattern.MatchString(errStr) || transientNetworkPattern.MatchString(errStr)
+}
+
+// IsRemoteNotFoundError checks if a remote operation failed because the remote repository does not exist
+func (em *ErrorMatcher) IsRemoteNotFoundError(stderr string) bool {
+	return remoteNotFoundPattern.MatchString(stderr)
+}
+
+// IsAuthenticationError checks if a remote operation failed because the remote refused the credentials
+func (em *ErrorMatcher) IsAuthenticationError(stderr string) bool {
+	return authenticationPattern.MatchString(stderr)
+}
+
 // IsMergeUpToDate checks if merge indicates already up to date
 func (em *ErrorMatcher) IsMergeUpToDate(mergeStderr string) bool {
 	return alreadyUpToDatePattern.MatchString(mergeStderr) ||
@@ -117,8 +159,8 @@ func (em *ErrorMatcher) ValidateCommitSHA(sha string) bool {
 		return false
 	}
 
-	// Validate length and hex format
-	if len(sha) < 4 || len(sha) > 40 {
+	// Validate length and hex format; full names are 40 (SHA-1) or 64 (SHA-256) characters long
+	if len(sha) < 4 || len(sha) > 64 {
 		return false
 	}
 
@@ -0,0 +1,189 @@
+package notes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// urlTrackingRefPrefix holds the remote-tracking notes refs of remotes given by URL. Each URL gets
+// its own directory named after a hash of the URL, so URLs never clash with configured remote
+// names or with each other.
+const urlTrackingRefPrefix = "refs/url-remotes/"
+
+// Remote describes a remote repository and how to reach it. Exactly one of Name and URL is set.
+type Remote struct {
+	// Name is a remote configured in the repository, e.g. "origin".
+	Name string
+	// URL is any URL or path git accepts, for remotes that are not configured.
+	URL string
+	// Env holds extra "KEY=value" environment entries for git commands talking to the remote,
+	// e.g. "GIT_SSH_COMMAND=ssh -i deploy_key".
+	Env []string
+	// Config holds configuration overrides passed as `git -c key=value`, e.g. "http.extraHeader"
+	// or "credential.helper".
+	Config map[string]string
+	// Timeout bounds each git command talking to the remote. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// NamedRemote returns a Remote for a configured remote name.
+func NamedRemote(name string) Remote {
+	return Remote{Name: name}
+}
+
+// RemoteURL returns a Remote for a URL or path.
+func RemoteURL(rawURL string) Remote {
+	return Remote{URL: rawURL}
+}
+
+// String returns the remote name or the URL without credentials.
+func (r Remote) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if u, err := url.Parse(r.URL); err == nil && u.User != nil {
+		u.User = nil
+		return u.String()
+	}
+	return r.URL
+}
+
+// target returns the repository argument passed to git fetch, push and ls-remote.
+func (r Remote) target() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.URL
+}
+
+func (r Remote) validate() error {
+	switch {
+	case r.Name == "" && r.URL == "":
+		return fmt.Errorf("remoteName cannot be empty")
+	case r.Name != "" && r.URL != "":
+		return fmt.Errorf("remote must have either a name or a URL, got name '%s' and URL '%s'", r.Name, r.String())
+	case strings.HasPrefix(r.target(), "-"):
+		return fmt.Errorf("invalid remote '%s'", r.target())
+	}
+	for key := range r.Config {
+		if key == "" || strings.ContainsAny(key, "= \t\n") {
+			return fmt.Errorf("invalid config key '%s' for remote '%s'", key, r)
+		}
+	}
+	return nil
+}
+
+// trackingRefPrefix returns the prefix under which the remote's notes refs are tracked locally,
+// e.g. "refs/remotes/origin/".
+func (r Remote) trackingRefPrefix() string {
+	if r.Name != "" {
+		return "refs/remotes/" + r.Name + "/"
+	}
+	sum := sha256.Sum256([]byte(r.URL))
+	return urlTrackingRefPrefix + hex.EncodeToString(sum[:8]) + "/"
+}
+
+// configArgs returns the `-c key=value` arguments for the remote's configuration overrides.
+func (r Remote) configArgs() []string {
+	keys := make([]string, 0, len(r.Config))
+	for key := range r.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		args = append(args, "-c", key+"="+r.Config[key])
+	}
+	return args
+}
+
+// git runs a git command that talks to the remote, with the remote's environment, configuration
+// overrides and timeout.
+func (r Remote) git(ctx context.Context, args ...string) (string, string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	stdout, stderr, err := runGitCommand(ctx, nil, r.Env, append(r.configArgs(), args...)...)
+	return stdout, stderr, r.classifyError(err)
+}
+
+// classifyError wraps the error of a failed git command that talked to the remote in
+// RemoteNotFoundError, AuthenticationError or NetworkError when it matches one of them.
+func (r Remote) classifyError(err error) error {
+	var gitErr *GitCommandError
+	if !errors.As(err, &gitErr) {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &NetworkError{Remote: r.String(), Err: err}
+	case errorMatcher.IsRemoteNotFoundError(gitErr.Stderr):
+		return &RemoteNotFoundError{Remote: r.String(), Err: err}
+	case errorMatcher.IsAuthenticationError(gitErr.Stderr):
+		return &AuthenticationError{Remote: r.String(), Err: err}
+	case errorMatcher.IsRemoteUnreachableError(gitErr.Stderr):
+		return &NetworkError{Remote: r.String(), Err: err}
+	}
+	return err
+}
+
+// rejectedPushError wraps the error of a failed push in a PushRejectedError if the remote rejected
+// any of the refs in statuses.
+func (r Remote) rejectedPushError(statuses []PushRefStatus, err error) error {
+	var rejected []PushRefStatus
+	for _, status := range statuses {
+		if status.Rejected() {
+			rejected = append(rejected, status)
+		}
+	}
+	if err == nil || len(rejected) == 0 {
+		return err
+	}
+	return &PushRejectedError{Remote: r.String(), Rejected: rejected, Err: err}
+}
+
+// fetchRef runs `git fetch` with args to fetch ref from the remote and reports whether the remote
+// has ref. A failed fetch only means that ref is missing if `git ls-remote --exit-code` exits with 2,
+// which does not depend on the git version or locale. If the remote has ref by the time it is
+// listed, ref was created after the fetch, which is run again. Any other failure, e.g. a bad URL
+// or an unknown remote, is returned with the stderr of the fetch.
+func (r Remote) fetchRef(ctx context.Context, ref string, args ...string) (bool, string, error) {
+	_, stderr, err := r.git(ctx, args...)
+	if err == nil {
+		return true, stderr, nil
+	}
+	_, _, lsErr := r.git(ctx, "ls-remote", "--exit-code", r.target(), ref)
+	switch {
+	case gitExitCode(lsErr) == 2:
+		return false, stderr, nil
+	case lsErr == nil:
+		_, stderr, err = r.git(ctx, args...)
+	}
+	return err == nil, stderr, err
+}
+
+// resolveRemote turns the remote argument of the string-based APIs into a Remote: configured remote
+// names and values that do not look like a URL or path are names, anything else is a URL.
+func resolveRemote(ctx context.Context, remote string) Remote {
+	if remote == "" || !looksLikeURL(remote) {
+		return NamedRemote(remote)
+	}
+	if _, _, err := executeGitCommandContext(ctx, "config", "--get", "remote."+remote+".url"); err == nil {
+		return NamedRemote(remote)
+	}
+	return RemoteURL(remote)
+}
+
+func looksLikeURL(remote string) bool {
+	return strings.ContainsAny(remote, ":/\\") || strings.HasPrefix(remote, ".") || strings.HasPrefix(remote, "~")
+}
@@ -0,0 +1,102 @@
+package notes
+
+import (
+	"bufio"
+	"strings"
+)
+
+// FetchResult describes the outcome of fetching notes for a namespace.
+type FetchResult struct {
+	Ref               string
+	RemoteTrackingRef string
+	// OldLocalTip and NewLocalTip are the local notes ref before and after the fetch ("" if absent).
+	OldLocalTip string
+	NewLocalTip string
+	// OldRemoteTip and NewRemoteTip are the last known remote notes tip before the fetch and the
+	// tip fetched from the remote ("" if the remote has no notes for this namespace).
+	OldRemoteTip string
+	NewRemoteTip string
+	// Merge describes the notes changed locally by merging the remote notes. It is nil when the
+	// remote has no notes for this namespace or when the local ref was force-overwritten.
+	Merge  *MergeResult
+	Forced bool
+	// AnnotatedCommits reports the fetch of the commits annotated by the notes. It is nil when the
+	// remote has no notes for this namespace and for dry runs.
+	AnnotatedCommits *AnnotatedCommitsResult
+}
+
+// Transferred reports whether the fetch brought in a remote notes tip that was not known before.
+func (r *FetchResult) Transferred() bool {
+	return r.OldRemoteTip != r.NewRemoteTip
+}
+
+// PushResult describes the outcome of pushing notes for a namespace.
+type PushResult struct {
+	Ref string
+	// OldLocalTip and NewLocalTip are the local notes ref before the push and after merging remote notes.
+	OldLocalTip string
+	NewLocalTip string
+	// OldRemoteTip is the remote notes tip seen by the last attempt before pushing ("" if absent) and
+	// NewRemoteTip the remote notes tip after a successful push.
+	OldRemoteTip string
+	NewRemoteTip string
+	// Merge describes the notes changed locally by merging remote notes across all attempts.
+	Merge *MergeResult
+	// Attempts is the number of fetch/merge/push cycles performed.
+	Attempts int
+	// RefStatuses holds the per-ref status reported by `git push --porcelain` in the last attempt.
+	RefStatuses []PushRefStatus
+}
+
+// UpToDate reports whether the push found the remote already at the local notes tip.
+func (r *PushResult) UpToDate() bool {
+	for _, status := range r.RefStatuses {
+		if !status.UpToDate() {
+			return false
+		}
+	}
+	return len(r.RefStatuses) > 0
+}
+
+// PushRefStatus is a single ref line of `git push --porcelain` output.
+type PushRefStatus struct {
+	// Flag is git's status flag: ' ' fast-forward, '+' forced update, '-' deleted, '*' new ref,
+	// '!' rejected or failed, '=' up to date.
+	Flag    byte
+	From    string
+	To      string
+	Summary string
+	// Reason is the parenthesized explanation git gives for rejections, e.g. "fetch first".
+	Reason string
+}
+
+// Rejected reports whether the remote refused to update the ref.
+func (s PushRefStatus) Rejected() bool {
+	return s.Flag == '!'
+}
+
+// UpToDate reports whether the remote ref already matched the pushed value.
+func (s PushRefStatus) UpToDate() bool {
+	return s.Flag == '='
+}
+
+// parsePushPorcelain parses the ref status lines of `git push --porcelain` output.
+func parsePushPorcelain(output string) []PushRefStatus {
+	var statuses []PushRefStatus
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// Ref lines are "<flag>\t<from>:<to>\t<summary> (<reason>)"
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 || len(fields[0]) != 1 {
+			continue
+		}
+		status := PushRefStatus{Flag: fields[0][0], Summary: fields[2]}
+		status.From, status.To, _ = strings.Cut(fields[1], ":")
+		if open := strings.Index(status.Summary, " ("); open >= 0 && strings.HasSuffix(status.Summary, ")") {
+			status.Reason = status.Summary[open+2 : len(status.Summary)-1]
+			status.Summary = status.Summary[:open]
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
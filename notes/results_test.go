@@ -0,0 +1,89 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePushPorcelain(t *testing.T) {
+	output := "To ../remote.git\n" +
+		"*\trefs/notes/a:refs/notes/a\t[new reference]\n" +
+		"=\trefs/notes/b:refs/notes/b\t[up to date]\n" +
+		"!\trefs/notes/c:refs/notes/c\t[rejected] (fetch first)\n" +
+		" \trefs/notes/d:refs/notes/d\t1111111..2222222\n" +
+		"Done\n"
+
+	expected := []PushRefStatus{
+		{Flag: '*', From: "refs/notes/a", To: "refs/notes/a", Summary: "[new reference]"},
+		{Flag: '=', From: "refs/notes/b", To: "refs/notes/b", Summary: "[up to date]"},
+		{Flag: '!', From: "refs/notes/c", To: "refs/notes/c", Summary: "[rejected]", Reason: "fetch first"},
+		{Flag: ' ', From: "refs/notes/d", To: "refs/notes/d", Summary: "1111111..2222222"},
+	}
+	statuses := parsePushPorcelain(output)
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("Unexpected statuses.\nExpected: %+v\nGot:      %+v", expected, statuses)
+	}
+	if !statuses[1].UpToDate() || !statuses[2].Rejected() || statuses[0].Rejected() {
+		t.Errorf("Status helpers returned unexpected values for %+v", statuses)
+	}
+}
+
+func TestPushAndFetchResults(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	otherSha := createTestCommit(t, localPath, "other.txt", "other", "Other commit")
+	manager := NewNotesManager("results")
+
+	if err := manager.SetNote(otherSha, "local"); err != nil {
+		t.Fatalf("SetNote failed: %v", err)
+	}
+	pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+
+	pushResult, err := manager.PushNotesWithResult("testorigin", DefaultRetryAttempts)
+	if err != nil {
+		t.Fatalf("PushNotesWithResult failed: %v", err)
+	}
+	if pushResult.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", pushResult.Attempts)
+	}
+	if pushResult.OldLocalTip == "" || pushResult.OldLocalTip == pushResult.NewLocalTip {
+		t.Errorf("Expected the local tip to move, got old=%q new=%q", pushResult.OldLocalTip, pushResult.NewLocalTip)
+	}
+	if pushResult.OldRemoteTip == "" || pushResult.NewRemoteTip != pushResult.NewLocalTip {
+		t.Errorf("Unexpected remote tips: old=%q new=%q (local %q)", pushResult.OldRemoteTip, pushResult.NewRemoteTip, pushResult.NewLocalTip)
+	}
+	if pushResult.Merge == nil || !reflect.DeepEqual(pushResult.Merge.Added, []string{commitSha}) {
+		t.Errorf("Expected the remote note to be reported as added, got %+v", pushResult.Merge)
+	}
+	if len(pushResult.RefStatuses) != 1 || pushResult.RefStatuses[0].Flag != ' ' || pushResult.UpToDate() {
+		t.Errorf("Expected a fast-forward push status, got %+v", pushResult.RefStatuses)
+	}
+
+	pushResult, err = manager.PushNotesWithResult("testorigin", DefaultRetryAttempts)
+	if err != nil {
+		t.Fatalf("Second PushNotesWithResult failed: %v", err)
+	}
+	if !pushResult.UpToDate() || !pushResult.Merge.UpToDate() {
+		t.Errorf("Expected second push to be up to date, got %+v", pushResult)
+	}
+
+	fetchResult, err := manager.FetchNotesWithResult("testorigin")
+	if err != nil {
+		t.Fatalf("FetchNotesWithResult failed: %v", err)
+	}
+	if fetchResult.Transferred() || !fetchResult.Merge.UpToDate() {
+		t.Errorf("Expected fetch after push to transfer nothing, got %+v", fetchResult)
+	}
+
+	runCmd(t, clonePath, "git", "fetch", "origin", "+"+manager.GetRef()+":"+manager.GetRef())
+	pushNoteFromClone(t, clonePath, manager.GetRef(), otherSha, "changed remotely")
+	fetchResult, err = manager.FetchNotesWithResult("testorigin")
+	if err != nil {
+		t.Fatalf("FetchNotesWithResult failed: %v", err)
+	}
+	if !fetchResult.Transferred() || fetchResult.OldLocalTip == fetchResult.NewLocalTip {
+		t.Errorf("Expected fetch to transfer and merge new notes, got %+v", fetchResult)
+	}
+	if fetchResult.Merge == nil || !reflect.DeepEqual(fetchResult.Merge.Changed, []string{otherSha}) {
+		t.Errorf("Expected the note to be reported as changed, got %+v", fetchResult.Merge)
+	}
+}
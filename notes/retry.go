@@ -0,0 +1,167 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// RetryPolicy controls how push, fetch and notes ref updates are retried.
+// Delays grow exponentially from BaseDelay by Multiplier, are randomized by Jitter so that
+// concurrent writers do not retry in lockstep, and are capped at MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Values below 1 mean 1.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// Multiplier scales the delay after every retry. Values below 1 mean 1.
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction in either direction (0 disables it, max 1).
+	Jitter float64
+	// MaxDelay caps a single delay. Zero means no cap.
+	MaxDelay time.Duration
+	// MaxElapsed stops retrying once the next attempt would start later than this after the first
+	// one. Zero means no limit.
+	MaxElapsed time.Duration
+	// Retryable decides whether an error is worth retrying. If nil, IsRetryableError is used.
+	Retryable func(error) bool
+	// OnAttempt, if set, is called after every attempt.
+	OnAttempt func(RetryAttempt)
+}
+
+// RetryAttempt describes a finished attempt of a retried operation.
+type RetryAttempt struct {
+	// Operation names the retried operation, e.g. "push", "fetch" or "update".
+	Operation string
+	Ref       string
+	// Attempt is 1 for the first attempt.
+	Attempt int
+	// Err is the error returned by the attempt, or nil if it succeeded.
+	Err error
+	// Elapsed is the time since the first attempt started.
+	Elapsed time.Duration
+	// WillRetry reports whether another attempt follows after Delay.
+	WillRetry bool
+	Delay     time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used by managers that are not configured otherwise.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultRetryAttempts,
+		BaseDelay:   100 * time.Millisecond,
+		Multiplier:  2,
+		Jitter:      0.5,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// WithRetryPolicy sets the retry policy used for pushes, fetches and notes ref updates.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(m *notesManager) {
+		m.retryPolicy = policy
+	}
+}
+
+// IsRetryableError reports whether err is a transient failure: a push rejected because the remote
+// moved, a notes ref that was updated concurrently, or a network error.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsPushRejected(err) || IsNetworkError(err) {
+		return true
+	}
+	// `git push --porcelain` reports rejected refs with a '!' flag regardless of the locale.
+	var gitErr *GitCommandError
+	if errors.As(err, &gitErr) && gitSubcommand(gitErr.Args) == "push" {
+		for _, status := range parsePushPorcelain(gitErr.Stdout) {
+			if status.Rejected() {
+				return true
+			}
+		}
+	}
+	errStr := err.Error()
+	return errorMatcher.IsPushRetryableError(errStr) ||
+		errorMatcher.IsRefLockError(errStr) ||
+		errorMatcher.IsTransientNetworkError(errStr)
+}
+
+// retryable reports whether the policy allows retrying err.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// delay returns the randomized delay to wait after the given (1-based) failed attempt.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	d := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if jitter := math.Min(p.Jitter, 1); jitter > 0 {
+		d *= 1 + jitter*(2*rand.Float64()-1)
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	return time.Duration(d)
+}
+
+// pushAttemptsKey is the context key of the listeners told how many attempts each retried push of
+// a call made.
+type pushAttemptsKey struct{}
+
+// withPushAttemptsListener returns a copy of ctx whose retried pushes also report their number of
+// attempts to listener.
+func withPushAttemptsListener(ctx context.Context, listener func(attempts int)) context.Context {
+	existing, _ := ctx.Value(pushAttemptsKey{}).([]func(int))
+	listeners := append(slices.Clip(existing), listener)
+	return context.WithValue(ctx, pushAttemptsKey{}, listeners)
+}
+
+// notifyPushAttempts reports the number of attempts a retried push made to the listeners of ctx.
+func notifyPushAttempts(ctx context.Context, attempts int) {
+	listeners, _ := ctx.Value(pushAttemptsKey{}).([]func(int))
+	for _, listener := range listeners {
+		listener(attempts)
+	}
+}
+
+// run calls attemptFn until it succeeds, returns a non-retryable error, or the policy is exhausted.
+// It returns the number of attempts made.
+func (p RetryPolicy) run(operation, ref string, attemptFn func() error) (int, error) {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := attemptFn()
+
+		info := RetryAttempt{Operation: operation, Ref: ref, Attempt: attempt, Err: err, Elapsed: time.Since(start)}
+		if err != nil && attempt < maxAttempts && p.retryable(err) {
+			info.Delay = p.delay(attempt)
+			info.WillRetry = p.MaxElapsed <= 0 || info.Elapsed+info.Delay <= p.MaxElapsed
+		}
+		if p.OnAttempt != nil {
+			p.OnAttempt(info)
+		}
+
+		if !info.WillRetry {
+			if err != nil && attempt > 1 {
+				return attempt, fmt.Errorf("%s of %s failed after %d attempts: %w", operation, ref, attempt, err)
+			}
+			return attempt, err
+		}
+		time.Sleep(info.Delay)
+	}
+}
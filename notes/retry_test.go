@@ -0,0 +1,106 @@
+package notes
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, Multiplier: 2, MaxDelay: 350 * time.Millisecond}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 350 * time.Millisecond, 350 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.delay(i + 1); got != want {
+			t.Errorf("delay(%d): expected %v, got %v", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	distinct := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		d := policy.delay(1)
+		if d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("Jittered delay %v outside of [50ms, 150ms]", d)
+		}
+		distinct[d] = true
+	}
+	if len(distinct) < 2 {
+		t.Errorf("Expected jitter to randomize delays, got %v", distinct)
+	}
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+
+	t.Run("RetriesClassifiedErrorsAndReportsAttempts", func(t *testing.T) {
+		var seen []RetryAttempt
+		policy := RetryPolicy{
+			MaxAttempts: 5,
+			BaseDelay:   time.Millisecond,
+			Retryable:   func(err error) bool { return errors.Is(err, errTransient) },
+			OnAttempt:   func(a RetryAttempt) { seen = append(seen, a) },
+		}
+		calls := 0
+		attempts, err := policy.run("push", "refs/notes/test", func() error {
+			calls++
+			if calls < 3 {
+				return errTransient
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Fatalf("Expected success after 3 attempts, got attempts=%d err=%v", attempts, err)
+		}
+		if len(seen) != 3 || !seen[0].WillRetry || !seen[1].WillRetry || seen[2].WillRetry || seen[2].Err != nil {
+			t.Errorf("Unexpected attempt reports: %+v", seen)
+		}
+		if seen[0].Operation != "push" || seen[0].Ref != "refs/notes/test" || seen[1].Attempt != 2 {
+			t.Errorf("Unexpected attempt metadata: %+v", seen[0])
+		}
+	})
+
+	t.Run("StopsOnNonRetryableError", func(t *testing.T) {
+		policy := RetryPolicy{MaxAttempts: 5, Retryable: func(err error) bool { return errors.Is(err, errTransient) }}
+		attempts, err := policy.run("push", "refs/notes/test", func() error { return errFatal })
+		if attempts != 1 || !errors.Is(err, errFatal) {
+			t.Errorf("Expected a single failed attempt, got attempts=%d err=%v", attempts, err)
+		}
+	})
+
+	t.Run("StopsAtMaxAttempts", func(t *testing.T) {
+		policy := RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return true }}
+		attempts, err := policy.run("push", "refs/notes/test", func() error { return errTransient })
+		if attempts != 3 || !errors.Is(err, errTransient) {
+			t.Errorf("Expected 3 failed attempts, got attempts=%d err=%v", attempts, err)
+		}
+	})
+
+	t.Run("StopsAtMaxElapsed", func(t *testing.T) {
+		policy := RetryPolicy{
+			MaxAttempts: 100,
+			BaseDelay:   20 * time.Millisecond,
+			MaxElapsed:  50 * time.Millisecond,
+			Retryable:   func(error) bool { return true },
+		}
+		attempts, err := policy.run("fetch", "refs/notes/test", func() error { return errTransient })
+		if err == nil || attempts < 2 || attempts > 4 {
+			t.Errorf("Expected MaxElapsed to stop retries after a few attempts, got attempts=%d err=%v", attempts, err)
+		}
+	})
+
+	t.Run("DefaultClassifier", func(t *testing.T) {
+		for _, msg := range []string{
+			"! [rejected] refs/notes/x -> refs/notes/x (fetch first)",
+			"fatal: cannot lock ref 'refs/notes/x': is at 1234 but expected 5678",
+			"fatal: unable to access 'https://example.com/': Could not resolve host: example.com",
+		} {
+			if !IsRetryableError(errors.New(msg)) {
+				t.Errorf("Expected %q to be retryable", msg)
+			}
+		}
+		if IsRetryableError(errors.New("fatal: 'nope' does not appear to be a git repository")) {
+			t.Error("Expected a missing remote not to be retryable")
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package notes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AllNamespaces selects every notes ref, locally and on the remote, in SyncNamespaces.
+const AllNamespaces = "refs/notes/*"
+
+// Namespace selects a notes namespace for SyncNamespaces together with the manager options
+// (such as its merge strategy or MergeFunc) used to merge it. Name may be a namespace, a full
+// "refs/notes/..." ref, or AllNamespaces; the options of a wildcard entry apply to every ref it
+// matches that is not also listed explicitly.
+type Namespace struct {
+	Name    string
+	Options []Option
+}
+
+// SyncResult reports the outcome of SyncNamespaces.
+type SyncResult struct {
+	// Merges holds the merge result for every notes ref that existed on the remote, keyed by ref.
+	Merges map[string]*MergeResult
+	// Pushed lists the notes refs included in the atomic push.
+	Pushed []string
+	// RefStatuses holds the per-ref status reported by `git push --porcelain`.
+	RefStatuses []PushRefStatus
+}
+
+// SyncNamespaces fetches, merges and pushes several notes namespaces at once. All requested notes
+// refs are fetched with a single `git fetch` using one refspec per namespace, each ref is merged
+// with its own strategy, and all refs are published with a single `git push --atomic`, so either
+// every namespace is updated on the remote or none is. Failures are retried with DefaultRetryPolicy,
+// and every attempt holds the repository lock configured by DefaultLockConfig. Command hooks set
+// with WithCommandHooks in a namespace's options see the commands shared by all namespaces as well
+// as those merging that namespace.
+func SyncNamespaces(remote string, namespaces []Namespace) (*SyncResult, error) {
+	return SyncNamespacesWith(resolveRemote(syncContext(namespaces), remote), namespaces)
+}
+
+// SyncNamespacesWith is like SyncNamespaces but takes a Remote, which may be a URL and may carry
+// its own environment, configuration overrides and timeout.
+func SyncNamespacesWith(remote Remote, namespaces []Namespace) (*SyncResult, error) {
+	if err := remote.validate(); err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("namespaces cannot be empty")
+	}
+
+	ctx := syncContext(namespaces)
+	var result *SyncResult
+	_, err := DefaultRetryPolicy().run("sync", remote.String(), func() error {
+		release, err := acquireRepoLock(ctx, DefaultLockConfig())
+		if err != nil {
+			return err
+		}
+		defer release()
+		result, err = syncNamespacesAttempt(ctx, remote, namespaces)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// syncContext returns the context of the commands of a sync, which carries the command hooks of
+// every namespace.
+func syncContext(namespaces []Namespace) context.Context {
+	ctx := context.Background()
+	for _, ns := range namespaces {
+		ctx = newNotesManager(ns.Name, ns.Options...).hookContext(ctx)
+	}
+	return ctx
+}
+
+// syncPlan holds the managers taking part in a sync, keyed by notes ref.
+type syncPlan struct {
+	ctx      context.Context
+	managers map[string]*notesManager
+	wildcard []Option
+	all      bool
+}
+
+func newSyncPlan(ctx context.Context, namespaces []Namespace) *syncPlan {
+	plan := &syncPlan{ctx: ctx, managers: make(map[string]*notesManager)}
+	for _, ns := range namespaces {
+		if ns.Name == AllNamespaces {
+			plan.all = true
+			plan.wildcard = ns.Options
+			continue
+		}
+		m := newNotesManager(ns.Name, ns.Options...)
+		m.ctx = ctx
+		plan.managers[m.ref] = m
+	}
+	return plan
+}
+
+// refs returns the notes refs of the plan in sorted order.
+func (p *syncPlan) refs() []string {
+	refs := make([]string, 0, len(p.managers))
+	for ref := range p.managers {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// expandWildcard adds a manager for every local or remote-tracking notes ref of remote. Legacy
+// remote-tracking refs and dry-run scratch refs under refs/notes/ are not namespaces and are skipped.
+func (p *syncPlan) expandWildcard(remote Remote) error {
+	if !p.all {
+		return nil
+	}
+	trackingPrefix := remote.trackingRefPrefix() + "notes/"
+	output, stderr, err := executeGitCommandContext(p.ctx, "for-each-ref", "--format=%(refname)", "refs/notes/", trackingPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list notes refs (stderr: %s): %w", stderr, err)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		ref := scanner.Text()
+		if strings.HasPrefix(ref, trackingPrefix) {
+			ref = "refs/notes/" + strings.TrimPrefix(ref, trackingPrefix)
+		}
+		if !isNamespaceRef(ref) {
+			continue
+		}
+		if _, ok := p.managers[ref]; !ok {
+			m := newNotesManager(ref, p.wildcard...)
+			m.ctx = p.ctx
+			p.managers[ref] = m
+		}
+	}
+	return scanner.Err()
+}
+
+func syncNamespacesAttempt(ctx context.Context, remote Remote, namespaces []Namespace) (*SyncResult, error) {
+	plan := newSyncPlan(ctx, namespaces)
+
+	// 1. Fetch every requested notes ref into its remote-tracking ref in one round trip.
+	if err := fetchSyncRefs(ctx, remote, plan); err != nil {
+		return nil, err
+	}
+	if err := plan.expandWildcard(remote); err != nil {
+		return nil, err
+	}
+
+	// 2. Merge each namespace with its own strategy.
+	result := &SyncResult{Merges: make(map[string]*MergeResult)}
+	var pushRefs []string
+	for _, ref := range plan.refs() {
+		m := plan.managers[ref]
+		remoteTrackingRef, err := buildRemoteTrackingRef(remote, ref)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := executeGitCommandContext(ctx, "rev-parse", "--verify", "--quiet", remoteTrackingRef); err == nil {
+			merge, err := m.mergeRemoteNotes(remoteTrackingRef)
+			if err != nil {
+				return nil, err
+			}
+			result.Merges[ref] = merge
+		}
+		if _, _, err := executeGitCommandContext(ctx, "rev-parse", "--verify", "--quiet", ref); err == nil {
+			pushRefs = append(pushRefs, ref)
+		}
+	}
+
+	// 3. Publish all namespaces atomically.
+	if len(pushRefs) > 0 {
+		args := append([]string{"push", "--atomic", "--porcelain", remote.target()}, pushRefs...)
+		pushStdout, pushStderr, pushErr := remote.git(ctx, args...)
+		result.RefStatuses = parsePushPorcelain(pushStdout)
+		pushErr = remote.rejectedPushError(result.RefStatuses, pushErr)
+		if pushErr != nil {
+			return nil, fmt.Errorf("failed to push notes refs %v to remote '%s': %w; stderr: %s",
+				pushRefs, remote, pushErr, pushStderr)
+		}
+	}
+	result.Pushed = pushRefs
+	return result, nil
+}
+
+// fetchSyncRefs fetches the notes refs of plan into their remote-tracking refs. Explicit refs that
+// do not exist on the remote make `git fetch` fail as a whole, so in that case the remote is asked
+// which of them exist and only those are fetched. A wildcard refspec never fails for missing refs.
+func fetchSyncRefs(ctx context.Context, remote Remote, plan *syncPlan) error {
+	refs := plan.refs()
+	refspecs, err := syncRefspecs(remote, refs, plan.all)
+	if err != nil {
+		return err
+	}
+
+	_, fetchStderr, fetchErr := remote.git(ctx, append([]string{"fetch", remote.target()}, refspecs...)...)
+	if fetchErr == nil {
+		return nil
+	}
+	if plan.all {
+		return fmt.Errorf("failed to fetch notes from remote '%s': %w; stderr: %s", remote, fetchErr, fetchStderr)
+	}
+
+	lsOutput, lsStderr, lsErr := remote.git(ctx, append([]string{"ls-remote", remote.target()}, refs...)...)
+	if lsErr != nil {
+		return fmt.Errorf("failed to list notes refs on remote '%s': %w; stderr: %s", remote, lsErr, lsStderr)
+	}
+
+	var existing []string
+	scanner := bufio.NewScanner(strings.NewReader(lsOutput))
+	for scanner.Scan() {
+		// Output of `git ls-remote` is "<sha>\t<ref>"
+		if _, ref, found := strings.Cut(scanner.Text(), "\t"); found {
+			if _, ok := plan.managers[ref]; ok {
+				existing = append(existing, ref)
+			}
+		}
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	refspecs, err = syncRefspecs(remote, existing, false)
+	if err != nil {
+		return err
+	}
+	_, fetchStderr, fetchErr = remote.git(ctx, append([]string{"fetch", remote.target()}, refspecs...)...)
+	if fetchErr != nil {
+		return fmt.Errorf("failed to fetch notes from remote '%s': %w; stderr: %s", remote, fetchErr, fetchStderr)
+	}
+	return nil
+}
+
+// syncRefspecs builds the fetch refspecs mapping refs to their remote-tracking refs.
+// When all is set a single wildcard refspec covers every notes ref, including refs.
+func syncRefspecs(remote Remote, refs []string, all bool) ([]string, error) {
+	if all {
+		return []string{"refs/notes/*:" + remote.trackingRefPrefix() + "notes/*"}, nil
+	}
+	var refspecs []string
+	for _, ref := range refs {
+		remoteTrackingRef, err := buildRemoteTrackingRef(remote, ref)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = append(refspecs, fmt.Sprintf("%s:%s", ref, remoteTrackingRef))
+	}
+	return refspecs, nil
+}
@@ -0,0 +1,132 @@
+package notes
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncNamespaces(t *testing.T) {
+	localPath, _, clonePath, commitSha := setupRemoteTestRepos(t)
+
+	t.Run("SingleFetchAndAtomicPush", func(t *testing.T) {
+		plain := NewNotesManager("sync-plain")
+		jsonNotes := NewNotesManager("sync-json")
+		missing := NewNotesManager("sync-missing-everywhere")
+
+		pushNoteFromClone(t, clonePath, plain.GetRef(), commitSha, "remote plain")
+		pushNoteFromClone(t, clonePath, jsonNotes.GetRef(), commitSha, `{"id":"remote"}`)
+		if err := plain.SetNote(commitSha, "local plain"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		if err := jsonNotes.SetNote(commitSha, `{"id":"local"}`); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+
+		var mu sync.Mutex
+		var fetches, pushes [][]string
+		cleanupHooks := setGitCommandHooksForTesting(func(args []string) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch args[0] {
+			case "fetch":
+				fetches = append(fetches, args)
+			case "push":
+				pushes = append(pushes, args)
+			}
+		}, nil)
+		defer cleanupHooks()
+
+		result, err := SyncNamespaces("testorigin", []Namespace{
+			{Name: "sync-plain"},
+			{Name: "sync-json", Options: []Option{WithMergeFunc(JSONMergeFunc("id"))}},
+			{Name: "sync-missing-everywhere"},
+		})
+		if err != nil {
+			t.Fatalf("SyncNamespaces failed: %v", err)
+		}
+
+		// The missing ref forces one fallback fetch after asking the remote which refs exist.
+		if len(fetches) != 2 || len(pushes) != 1 {
+			t.Fatalf("Expected 2 fetches and 1 push, got fetches=%v pushes=%v", fetches, pushes)
+		}
+		if pushes[0][1] != "--atomic" {
+			t.Errorf("Expected an atomic push, got %v", pushes[0])
+		}
+		if !reflect.DeepEqual(result.Pushed, []string{jsonNotes.GetRef(), plain.GetRef()}) {
+			t.Errorf("Unexpected pushed refs: %v", result.Pushed)
+		}
+		if _, ok := result.Merges[missing.GetRef()]; ok {
+			t.Errorf("Missing namespace should not have been merged: %+v", result.Merges)
+		}
+		if merge := result.Merges[jsonNotes.GetRef()]; merge == nil || merge.Strategy != MergeManual {
+			t.Errorf("Expected JSON namespace to be merged manually, got %+v", merge)
+		}
+
+		note, _ := plain.GetNote(commitSha)
+		if !strings.Contains(note, "local plain") || !strings.Contains(note, "remote plain") {
+			t.Errorf("Plain namespace not merged with cat_sort_uniq: %q", note)
+		}
+		note, _ = jsonNotes.GetNote(commitSha)
+		if note != `{"id":"local"}`+"\n"+`{"id":"remote"}` {
+			t.Errorf("JSON namespace not merged with JSONMergeFunc: %q", note)
+		}
+
+		remoteRefs, _ := runCmd(t, localPath, "git", "ls-remote", "testorigin", "refs/notes/sync-*")
+		if !strings.Contains(remoteRefs, plain.GetRef()) || !strings.Contains(remoteRefs, jsonNotes.GetRef()) {
+			t.Errorf("Expected both namespaces on the remote, got:\n%s", remoteRefs)
+		}
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		remoteOnly := "refs/notes/sync-wildcard-remote"
+		localOnly := NewNotesManager("sync-wildcard-local")
+		pushNoteFromClone(t, clonePath, remoteOnly, commitSha, "remote only")
+		if err := localOnly.SetNote(commitSha, "local only"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+
+		result, err := SyncNamespaces("testorigin", []Namespace{{Name: AllNamespaces}})
+		if err != nil {
+			t.Fatalf("SyncNamespaces with wildcard failed: %v", err)
+		}
+		if _, ok := result.Merges[remoteOnly]; !ok {
+			t.Errorf("Expected remote-only namespace to be merged, got %v", result.Merges)
+		}
+
+		if note, err := NewNotesManager(remoteOnly).GetNote(commitSha); err != nil || note != "remote only" {
+			t.Errorf("Remote-only namespace not fetched: note=%q err=%v", note, err)
+		}
+		remoteNote, _ := runCmd(t, clonePath, "git", "ls-remote", "origin", localOnly.GetRef())
+		if !strings.Contains(remoteNote, localOnly.GetRef()) {
+			t.Errorf("Local-only namespace not pushed, ls-remote: %q", remoteNote)
+		}
+	})
+
+	t.Run("WildcardSkipsTrackingAndScratchRefs", func(t *testing.T) {
+		tip := refTip(context.Background(), "refs/notes/sync-wildcard-local")
+		legacy := "refs/notes/remotes/origin/x"
+		scratch := newScratchRef()
+		runCmd(t, localPath, "git", "update-ref", legacy, tip)
+		runCmd(t, localPath, "git", "update-ref", scratch, tip)
+
+		result, err := SyncNamespaces("testorigin", []Namespace{{Name: AllNamespaces}})
+		if err != nil {
+			t.Fatalf("SyncNamespaces with wildcard failed: %v", err)
+		}
+		for _, ref := range []string{legacy, scratch} {
+			if slices.Contains(result.Pushed, ref) {
+				t.Errorf("Expected %s not to be pushed, got %v", ref, result.Pushed)
+			}
+			if lsRemote, _ := runCmd(t, clonePath, "git", "ls-remote", "origin", ref); lsRemote != "" {
+				t.Errorf("Expected %s not to reach the remote, ls-remote: %q", ref, lsRemote)
+			}
+		}
+		if !slices.Contains(result.Pushed, "refs/notes/sync-wildcard-local") {
+			t.Errorf("Expected the namespaces to be pushed, got %v", result.Pushed)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package notes
+
+import (
+	"context"
+	"strings"
+)
+
+// NewTracedNotesManager wraps manager so that each of its calls is traced with a span named
+// "notes.<Method>", with a child span "git <subcommand>" for every git command it runs.
+// The calls taking a context start their span as a child of the span in that context.
+func NewTracedNotesManager(manager NotesManager, tracer Tracer) NotesManager {
+	return &instrumentedNotesManager{NotesManager: manager, instrument: traceCalls(manager, tracer)}
+}
+
+// tracedGitCommandKey keys the git command listener of the innermost traced call, so git commands
+// are traced once, under the span of that call.
+type tracedGitCommandKey struct{}
+
+// traceCalls returns the instrumenter starting the span of each call of manager as a child of the
+// call's parent context. The calls run with a context under which their git commands are traced
+// as child spans.
+func traceCalls(manager NotesManager, tracer Tracer) callInstrumenter {
+	return func(ctx context.Context, call managerCall) (context.Context, func(any, error)) {
+		attrs := []Attribute{{Key: "notes.namespace", Value: manager.GetRef()}}
+		if call.shas > 0 {
+			attrs = append(attrs, Attribute{Key: "notes.shas", Value: call.shas})
+		}
+		if call.remote != "" {
+			attrs = append(attrs, Attribute{Key: "notes.remote", Value: call.remote})
+		}
+		ctx, span := tracer.Start(ctx, "notes."+call.operation, attrs...)
+		spanCtx := ctx
+		ctx = withGitCommandListener(ctx, tracedGitCommandKey{}, func(command *GitCommand) func() {
+			_, span := tracer.Start(spanCtx, "git "+gitSubcommand(command.Args),
+				Attribute{Key: "git.args", Value: strings.Join(command.Args, " ")})
+			return func() {
+				span.SetAttributes(
+					Attribute{Key: "git.exit_code", Value: command.ExitCode},
+					Attribute{Key: "git.bytes_in", Value: command.BytesIn},
+					Attribute{Key: "git.bytes_out", Value: command.BytesOut},
+				)
+				if command.Err != nil {
+					span.RecordError(command.Err)
+				}
+				span.End()
+			}
+		})
+
+		return ctx, func(_ any, err error) {
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+		}
+	}
+}
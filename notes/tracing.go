@@ -0,0 +1,153 @@
+package notes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Attribute is a key/value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span is an operation being traced.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans. The parent of a span is the span carried by ctx, as with OpenTelemetry
+// tracers, so a Tracer can be implemented by adapting an OpenTelemetry trace.Tracer.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// SpanData is a finished span of the tracer returned by NewTracer.
+type SpanData struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	ParentID string // "" for root spans
+	Start    time.Time
+	End      time.Time
+	// Attributes are in the order they were set.
+	Attributes []Attribute
+	Err        error
+}
+
+// Attribute returns the value of the last attribute with the given key, or nil.
+func (s SpanData) Attribute(key string) any {
+	var value any
+	for _, attr := range s.Attributes {
+		if attr.Key == key {
+			value = attr.Value
+		}
+	}
+	return value
+}
+
+// SpanExporter receives the spans of the tracer returned by NewTracer as they end.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+type exportingTracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer returns a Tracer that sends each span to exporter when it ends.
+func NewTracer(exporter SpanExporter) Tracer {
+	return &exportingTracer{exporter: exporter}
+}
+
+type spanContextKey struct{}
+
+type exportingSpan struct {
+	tracer *exportingTracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (t *exportingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &exportingSpan{tracer: t, data: SpanData{
+		Name:       name,
+		SpanID:     randomID(8),
+		Start:      time.Now(),
+		Attributes: append([]Attribute(nil), attrs...),
+	}}
+	if parent, ok := ctx.Value(spanContextKey{}).(*exportingSpan); ok {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentID = parent.data.SpanID
+	} else {
+		span.data.TraceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+func (s *exportingSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+func (s *exportingSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+func (s *exportingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.exporter.ExportSpans(context.Background(), []SpanData{data})
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// InMemoryExporter is a SpanExporter keeping the spans in memory, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpans(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the exported spans in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset drops the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
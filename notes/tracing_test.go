@@ -0,0 +1,154 @@
+package notes
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTracedNotesManager(t *testing.T) {
+	_, _, clonePath, commitSha := setupRemoteTestRepos(t)
+	exporter := NewInMemoryExporter()
+	manager := NewTracedNotesManager(NewNotesManager("traced"), NewTracer(exporter))
+
+	t.Run("PushNotes", func(t *testing.T) {
+		if err := manager.SetNote(commitSha, "local"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		pushNoteFromClone(t, clonePath, manager.GetRef(), commitSha, "remote")
+		exporter.Reset()
+		if err := manager.PushNotes("testorigin"); err != nil {
+			t.Fatalf("PushNotes failed: %v", err)
+		}
+
+		spans := exporter.Spans()
+		root := spans[len(spans)-1]
+		if root.Name != "notes.PushNotes" || root.ParentID != "" || root.Attribute("notes.remote") != "testorigin" {
+			t.Fatalf("Expected the PushNotes span to end last, got %+v", root)
+		}
+		commands := make(map[string]bool)
+		for _, span := range spans[:len(spans)-1] {
+			if span.ParentID != root.SpanID || span.TraceID != root.TraceID {
+				t.Errorf("Expected %s to be a child of the PushNotes span", span.Name)
+			}
+			if span.Start.Before(root.Start) || span.End.After(root.End) {
+				t.Errorf("Expected %s to run within the PushNotes span", span.Name)
+			}
+			if _, ok := span.Attribute("git.exit_code").(int); !ok {
+				t.Errorf("Expected an exit code on %s", span.Name)
+			}
+			commands[span.Name] = true
+		}
+		for _, name := range []string{"git fetch", "git notes", "git push"} {
+			if !commands[name] {
+				t.Errorf("Expected a %q span, got %v", name, commands)
+			}
+		}
+	})
+
+	t.Run("FailedCommand", func(t *testing.T) {
+		exporter.Reset()
+		if _, err := manager.GetNote("deadbeef"); !IsInvalidCommitSha(err) {
+			t.Fatalf("Expected InvalidCommitShaError, got %v", err)
+		}
+		spans := exporter.Spans()
+		root := spans[len(spans)-1]
+		if root.Name != "notes.GetNote" || !IsInvalidCommitSha(root.Err) {
+			t.Errorf("Expected the error on the GetNote span, got %+v", root)
+		}
+		show := spans[0]
+		if show.Name != "git notes" || show.Attribute("git.exit_code") == 0 || show.Err == nil {
+			t.Errorf("Expected a failed git notes span, got %+v", show)
+		}
+		if args, _ := show.Attribute("git.args").(string); !strings.HasSuffix(args, "deadbeef") {
+			t.Errorf("Unexpected git args %q", args)
+		}
+	})
+
+	t.Run("ParentFromContext", func(t *testing.T) {
+		exporter.Reset()
+		ctx, span := NewTracer(exporter).Start(context.Background(), "caller")
+		if _, err := manager.GetNoteWithContext(ctx, commitSha); err != nil {
+			t.Fatalf("GetNoteWithContext failed: %v", err)
+		}
+		span.End()
+		spans := exporter.Spans()
+		caller, get := spans[len(spans)-1], spans[len(spans)-2]
+		if get.Name != "notes.GetNoteWithContext" || get.ParentID != caller.SpanID {
+			t.Errorf("Expected the manager span to be a child of the caller, got %+v", get)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		other := NewTracedNotesManager(NewNotesManager("traced-other"), NewTracer(exporter))
+		if err := other.SetNote(commitSha, "other"); err != nil {
+			t.Fatalf("SetNote failed: %v", err)
+		}
+		// The command of the first call runs while the second call is in progress.
+		firstStarted, secondStarted, firstDone := make(chan struct{}), make(chan struct{}), make(chan struct{})
+		var firstOnce, secondOnce sync.Once
+		restore := setGitCommandHooksForTesting(func(args []string) {
+			switch {
+			case slices.Contains(args, manager.GetRef()):
+				firstOnce.Do(func() { close(firstStarted) })
+				<-secondStarted
+			case slices.Contains(args, other.GetRef()):
+				secondOnce.Do(func() { close(secondStarted) })
+				<-firstDone
+			}
+		}, nil)
+		defer restore()
+
+		exporter.Reset()
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			defer close(firstDone)
+			if _, err := manager.GetNote(commitSha); err != nil {
+				t.Errorf("GetNote failed: %v", err)
+			}
+		}()
+		<-firstStarted
+		go func() {
+			defer wg.Done()
+			if _, err := other.GetNote(commitSha); err != nil {
+				t.Errorf("GetNote failed: %v", err)
+			}
+		}()
+		wg.Wait()
+
+		namespaces := make(map[string]string)
+		for _, span := range exporter.Spans() {
+			if span.Name == "notes.GetNote" {
+				namespaces[span.SpanID], _ = span.Attribute("notes.namespace").(string)
+			}
+		}
+		var commands int
+		for _, span := range exporter.Spans() {
+			if span.Name != "git notes" {
+				continue
+			}
+			commands++
+			args, _ := span.Attribute("git.args").(string)
+			if namespace := namespaces[span.ParentID]; !strings.Contains(args, "--ref "+namespace+" ") {
+				t.Errorf("Command %q traced under a call for %q", args, namespace)
+			}
+		}
+		if len(namespaces) != 2 || commands != 2 {
+			t.Errorf("Expected 2 calls and commands, got %d and %d", len(namespaces), commands)
+		}
+	})
+
+	t.Run("Untraced", func(t *testing.T) {
+		exporter.Reset()
+		if _, err := NewNotesManager("traced").GetNote(commitSha); err != nil {
+			t.Fatalf("GetNote failed: %v", err)
+		}
+		if spans := exporter.Spans(); len(spans) != 0 {
+			t.Errorf("Expected no spans outside traced calls, got %d", len(spans))
+		}
+	})
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
 )
 
 var errorMatcher = NewErrorMatcher()
@@ -51,6 +53,72 @@ func setGitCommandHooksForTesting(before, after gitCommandHook) func() {
 	}
 }
 
+// gitCommandListener is called when a git command starts. The function it returns, if not nil, is
+// called when the command finishes, once the remaining fields of command are set. Listeners must
+// not modify command.
+type gitCommandListener func(command *GitCommand) func()
+
+// gitListenersKey is the context key of the git command listeners of a call.
+type gitListenersKey struct{}
+
+type keyedGitCommandListener struct {
+	key      any
+	listener gitCommandListener
+}
+
+// withGitCommandListener returns a copy of ctx whose git commands are also reported to listener.
+// A listener added with the same non-nil key as an earlier one replaces it.
+func withGitCommandListener(ctx context.Context, key any, listener gitCommandListener) context.Context {
+	existing, _ := ctx.Value(gitListenersKey{}).([]keyedGitCommandListener)
+	listeners := make([]keyedGitCommandListener, 0, len(existing)+1)
+	for _, l := range existing {
+		if key == nil || l.key != key {
+			listeners = append(listeners, l)
+		}
+	}
+	listeners = append(listeners, keyedGitCommandListener{key: key, listener: listener})
+	return context.WithValue(ctx, gitListenersKey{}, listeners)
+}
+
+// notifyGitCommandStarted calls the listeners of ctx with the description of a command about to
+// start. It returns the description and the function notifying the listeners when the command
+// finishes, or nil if none is interested.
+func notifyGitCommandStarted(ctx context.Context, args, env []string, start time.Time) (*GitCommand, func()) {
+	listeners, _ := ctx.Value(gitListenersKey{}).([]keyedGitCommandListener)
+	if len(listeners) == 0 {
+		return nil, nil
+	}
+
+	command := &GitCommand{Args: redactArgs(args), Env: redactEnv(env), Start: start}
+	command.Dir, _ = os.Getwd()
+	var finished []func()
+	for _, l := range listeners {
+		if f := l.listener(command); f != nil {
+			finished = append(finished, f)
+		}
+	}
+	if len(finished) == 0 {
+		return nil, nil
+	}
+	return command, func() {
+		for _, f := range finished {
+			f()
+		}
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // formatNamespaceRef ensures the namespace has the correct prefix for git.
 // If the namespace already starts with "refs/notes/", it's returned as is.
 // Otherwise, "refs/notes/" is prepended.
@@ -65,6 +133,43 @@ func formatNamespaceRef(namespace string) string {
 	return "refs/notes/" + namespace
 }
 
+// refTip returns the object name ref points to, or "" if ref does not exist.
+func refTip(ctx context.Context, ref string) string {
+	tip, _, err := executeGitCommandContext(ctx, "rev-parse", "--verify", "--quiet", ref)
+	if err != nil {
+		return ""
+	}
+	return tip
+}
+
+// verifyRef reports whether ref exists. Unlike refTip, it fails when that cannot be determined:
+// outside a repository or when ref is broken.
+func verifyRef(ctx context.Context, ref string) (bool, error) {
+	_, stderr, err := executeGitCommandContext(ctx, "rev-parse", "--verify", "--quiet", ref)
+	if err == nil {
+		return true, nil
+	}
+	// With --quiet a missing ref exits with 1 and prints nothing; a broken one prints a warning.
+	if gitExitCode(err) == 1 && stderr == "" {
+		return false, nil
+	}
+	if repoErr := checkRepository(ctx); repoErr != nil {
+		return false, repoErr
+	}
+	return false, fmt.Errorf("failed to verify %s (stderr: %s): %w", ref, strings.TrimSpace(stderr), err)
+}
+
+// checkRepository returns a NotARepositoryError if the working directory is not inside a git
+// repository.
+func checkRepository(ctx context.Context) error {
+	_, _, err := executeGitCommandContext(ctx, "rev-parse", "--git-dir")
+	if err != nil && gitExitCode(err) == 128 {
+		cwd, _ := os.Getwd()
+		return &NotARepositoryError{Path: cwd, Err: err}
+	}
+	return err
+}
+
 // validateCommitSHA validates that a commit SHA is in the correct format.
 // It allows empty strings (which will be resolved to HEAD), but checks for
 // potentially dangerous inputs and validates hex format.
@@ -78,68 +183,138 @@ func validateCommitSHA(sha string) error {
 // executeGitCommand is a helper function to run git commands and capture their output and errors.
 // It returns stdout, stderr, and an error.
 func executeGitCommand(args ...string) (string, string, error) {
-	argsCopy := append([]string(nil), args...)
-	runGitCommandHook(true, argsCopy)
-	defer runGitCommandHook(false, argsCopy)
+	return runGitCommand(context.Background(), nil, nil, args...)
+}
 
-	cmd := exec.Command("git", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Env = append(
-		os.Environ(),
-		"GIT_AUTHOR_NAME=Library Notes",
-		"GIT_AUTHOR_EMAIL=lib@example.com",
-		"GIT_COMMITTER_NAME=Library Notes",
-		"GIT_COMMITTER_EMAIL=lib@example.com",
-	)
+// executeGitCommandContext is like executeGitCommand but with context support for cancellation.
+// ctx also carries the git command listeners of the call the command is run for.
+func executeGitCommandContext(ctx context.Context, args ...string) (string, string, error) {
+	return runGitCommand(ctx, nil, nil, args...)
+}
 
-	err := cmd.Run()
+// executeGitCommandInputContext is like executeGitCommandContext but feeds input to the command's stdin.
+func executeGitCommandInputContext(ctx context.Context, input string, args ...string) (string, string, error) {
+	return runGitCommand(ctx, strings.NewReader(input), nil, args...)
+}
 
-	if err != nil {
-		// Check for specific exit codes
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return stdout.String(), stderr.String(), fmt.Errorf("git %s failed with exit code %d: %w; stderr: %s",
-				args[0], exitErr.ExitCode(), err, stderr.String())
+// Notes commits are recorded with the library identity when git has no identity of its own, e.g.
+// in containers without user.name and user.email whose hostname has no domain.
+const (
+	libraryIdentityName  = "Library Notes"
+	libraryIdentityEmail = "lib@example.com"
+)
+
+// fallbackIdentities caches fallbackIdentityEnv by working directory and configuration location.
+var fallbackIdentities sync.Map
+
+// fallbackIdentityEnv returns the environment entries setting the library identity as the author
+// or committer for which `git var` finds no identity in the current repository.
+func fallbackIdentityEnv() []string {
+	cwd, _ := os.Getwd()
+	key := strings.Join([]string{cwd, os.Getenv("HOME"), os.Getenv("XDG_CONFIG_HOME"), os.Getenv("GIT_CONFIG_GLOBAL")}, "\x00")
+	if env, ok := fallbackIdentities.Load(key); ok {
+		return env.([]string)
+	}
+
+	var env []string
+	for _, role := range []string{"AUTHOR", "COMMITTER"} {
+		cmd := exec.Command("git", "var", "GIT_"+role+"_IDENT")
+		cmd.Env = append(os.Environ(), "LC_ALL=C", "LANGUAGE=")
+		if cmd.Run() != nil {
+			env = append(env, "GIT_"+role+"_NAME="+libraryIdentityName, "GIT_"+role+"_EMAIL="+libraryIdentityEmail)
 		}
-		return stdout.String(), stderr.String(), fmt.Errorf("git %s failed: %w; stderr: %s", args[0], err, stderr.String())
 	}
-	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), nil
+	fallbackIdentities.Store(key, env)
+	return env
 }
 
-// executeGitCommandContext is like executeGitCommand but with context support for cancellation
-func executeGitCommandContext(ctx context.Context, args ...string) (string, string, error) {
+// runGitCommand runs git with the given arguments, stdin and context. env holds extra environment
+// entries that override the inherited ones.
+func runGitCommand(ctx context.Context, stdin io.Reader, env []string, args ...string) (string, string, error) {
 	argsCopy := append([]string(nil), args...)
 	runGitCommandHook(true, argsCopy)
 	defer runGitCommandHook(false, argsCopy)
 
 	cmd := exec.CommandContext(ctx, "git", args...)
 	var stdout, stderr bytes.Buffer
+	var stdinCount *countingReader
+	if stdin != nil {
+		stdinCount = &countingReader{r: stdin}
+		cmd.Stdin = stdinCount
+	}
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	cmd.Env = append(
-		os.Environ(),
-		"GIT_AUTHOR_NAME=Library Notes",
-		"GIT_AUTHOR_EMAIL=lib@example.com",
-		"GIT_COMMITTER_NAME=Library Notes",
-		"GIT_COMMITTER_EMAIL=lib@example.com",
-	)
+	libraryEnv := append([]string{
+		// Git messages are translated unless the locale is "C", which also makes gettext ignore
+		// LANGUAGE. Failures are classified by exit codes and plumbing output wherever possible,
+		// but the remaining message checks need untranslated output.
+		"LC_ALL=C",
+		"LANGUAGE=",
+	}, fallbackIdentityEnv()...)
+	libraryEnv = append(libraryEnv, env...)
+	cmd.Env = append(os.Environ(), libraryEnv...)
 
+	start := time.Now()
+	command, finished := notifyGitCommandStarted(ctx, argsCopy, libraryEnv, start)
 	err := cmd.Run()
+	if finished != nil {
+		command.Duration = time.Since(start)
+		command.ExitCode = cmd.ProcessState.ExitCode()
+		command.BytesOut = int64(stdout.Len())
+		if stdinCount != nil {
+			command.BytesIn = stdinCount.n
+		}
+		command.Err = err
+		finished()
+	}
 
 	if err != nil {
+		gitErr := &GitCommandError{
+			Args:     redactArgs(argsCopy),
+			ExitCode: -1,
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			Duration: time.Since(start),
+			Err:      err,
+		}
 		// Check if context was cancelled
 		if ctx.Err() != nil {
-			return stdout.String(), stderr.String(), fmt.Errorf("command cancelled: %w", ctx.Err())
+			gitErr.Err = ctx.Err()
+			return gitErr.Stdout, gitErr.Stderr, gitErr
 		}
 
+		// Check for specific exit codes
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
-			return stdout.String(), stderr.String(), fmt.Errorf("git %s failed with exit code %d: %w; stderr: %s",
-				args[0], exitErr.ExitCode(), err, stderr.String())
+			gitErr.ExitCode = exitErr.ExitCode()
 		}
-		return stdout.String(), stderr.String(), fmt.Errorf("git %s failed: %w; stderr: %s", args[0], err, stderr.String())
+		return gitErr.Stdout, gitErr.Stderr, gitErr
 	}
 	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), nil
 }
+
+// gitExitCode returns the exit code of the failed git command wrapped in err, or -1 if there is none.
+func gitExitCode(err error) int {
+	var gitErr *GitCommandError
+	if errors.As(err, &gitErr) {
+		return gitErr.ExitCode
+	}
+	return -1
+}
+
+// isAncestor reports whether commit ancestor is reachable from descendant.
+func isAncestor(ctx context.Context, ancestor, descendant string) bool {
+	_, _, err := executeGitCommandContext(ctx, "merge-base", "--is-ancestor", ancestor, descendant)
+	return err == nil
+}
+
+// gitSubcommand returns the git subcommand of args, skipping leading `-c key=value` options.
+func gitSubcommand(args []string) string {
+	for len(args) >= 2 && args[0] == "-c" {
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}